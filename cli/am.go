@@ -0,0 +1,169 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/fatih/color"
+	"github.com/isacikgoz/gitin/git"
+	"github.com/isacikgoz/promptui"
+	"github.com/isacikgoz/promptui/screenbuf"
+)
+
+// AmOptions is the options of the am command
+type AmOptions struct {
+	Mailbox   string
+	PromptOps *PromptOptions
+}
+
+// AmBuilder applies the patches of the mailbox one by one, the patches can
+// be previewed or skipped before they are applied. If a session is already
+// in progress it is resumed with the rest of its series.
+func AmBuilder(r *git.Repository, opts *AmOptions) error {
+	if r.IsBare() {
+		return git.ErrBareRepository
+	}
+	if r.ApplyingMailbox() {
+		if len(opts.Mailbox) > 0 {
+			return errors.New("a patch is being applied, run am without a mailbox to resolve it first")
+		}
+		stopped, err := resolvePatchPrompt(r, opts.PromptOps, nil)
+		if err != nil || stopped {
+			return err
+		}
+		patches, err := r.PendingPatches()
+		if err != nil || len(patches) == 0 {
+			return err
+		}
+		return applyPatches(r, patches, "the remaining patches", opts.PromptOps)
+	}
+	if len(opts.Mailbox) == 0 {
+		return errors.New("there is no patch being applied, give a mailbox to apply")
+	}
+	patches, err := git.SplitMailbox(opts.Mailbox)
+	if err != nil {
+		return err
+	}
+	return applyPatches(r, patches, opts.Mailbox, opts.PromptOps)
+}
+
+// applyPatches asks for the patches one by one. The patches after the one
+// being applied are kept, so that the series goes on when a failed patch is
+// resolved in another run.
+func applyPatches(r *git.Repository, patches []*git.MailPatch, name string, opts *PromptOptions) error {
+	for i, p := range patches {
+		if err := r.SavePendingPatches(patches[i+1:]); err != nil {
+			return err
+		}
+		label := "[" + strconv.Itoa(i+1) + "/" + strconv.Itoa(len(patches)) + "] " + p.Title()
+		done, err := applyPatchPrompt(r, p, label, opts)
+		if err != nil || done {
+			if !r.ApplyingMailbox() {
+				r.SavePendingPatches(nil)
+			}
+			return err
+		}
+	}
+	fmt.Println("Applied " + name)
+	return r.SavePendingPatches(nil)
+}
+
+// applyPatchPrompt asks what to do with the patch, done is true if the
+// series should not go on
+func applyPatchPrompt(r *git.Repository, p *git.MailPatch, label string, opts *PromptOptions) (bool, error) {
+	const (
+		apply   = "Apply"
+		preview = "Preview"
+		skip    = "Skip"
+		abort   = "Stop here"
+	)
+	items := []string{apply, preview, skip, abort}
+	cursor := 0
+	for {
+		prompt := promptui.Select{
+			Label:     label,
+			Items:     items,
+			HideHelp:  opts.HideHelp,
+			Size:      opts.Size,
+			Templates: patchTemplate(p),
+		}
+		i, _, err := prompt.RunCursorAt(cursor, 0)
+		if err != nil {
+			return true, nil
+		}
+		switch items[i] {
+		case preview:
+			screenbuf.Clear(os.Stdin)
+			popMore(p.Raw)
+			cursor = i
+			continue
+		case skip:
+			fmt.Println("Skipped " + p.Title())
+			return false, nil
+		case abort:
+			return true, nil
+		}
+		if err := r.ApplyPatch(p); err != nil {
+			if !r.ApplyingMailbox() {
+				return true, err
+			}
+			// the patch did not apply, the session waits to be resolved
+			return resolvePatchPrompt(r, opts, err)
+		}
+		fmt.Println("Applied " + p.Title())
+		return false, nil
+	}
+}
+
+// resolvePatchPrompt is shown while a patch fails to apply, the conflicts
+// can be resolved elsewhere before continuing. stopped is true if the
+// session is aborted or left unresolved.
+func resolvePatchPrompt(r *git.Repository, opts *PromptOptions, cause error) (stopped bool, err error) {
+	const (
+		resolved = "Continue, the conflicts are resolved"
+		skip     = "Skip this patch"
+		abort    = "Abort, keep the patches applied before this one"
+	)
+	if cause != nil {
+		red := color.New(color.FgRed)
+		fmt.Println(red.Sprint(cause.Error()))
+	}
+	items := []string{resolved, skip, abort}
+	prompt := promptui.Select{
+		Label:     "Applying a mailbox is in progress",
+		Items:     items,
+		HideHelp:  opts.HideHelp,
+		Size:      opts.Size,
+		Templates: stringsTemplate(),
+	}
+	i, _, perr := prompt.Run()
+	if perr != nil {
+		fmt.Println("The patch is left unresolved, run am again to resolve it")
+		return true, nil
+	}
+	switch items[i] {
+	case resolved:
+		err = r.ContinueApply()
+	case skip:
+		err = r.SkipPatch()
+	case abort:
+		stopped = true
+		err = r.AbortApply()
+	}
+	if err != nil && r.ApplyingMailbox() {
+		return resolvePatchPrompt(r, opts, err)
+	}
+	return stopped || err != nil, err
+}
+
+func patchTemplate(p *git.MailPatch) *promptui.SelectTemplates {
+	templates := stringsTemplate()
+	templates.Details = "\n" +
+		"---------------- Patch -----------------" + "\n" +
+		"{{ \"From:\"    | faint }}    " + p.From + "\n" +
+		"{{ \"Date:\"    | faint }}    " + p.Date + "\n" +
+		"{{ \"Subject:\" | faint }} " + p.Subject
+	return templates
+}
@@ -1,20 +1,31 @@
 package cli
 
 import (
+	"errors"
 	"fmt"
 	"os"
-	"os/exec"
+	"sort"
+	"strings"
+	"sync"
 
+	"github.com/fatih/color"
 	"github.com/isacikgoz/gitin/git"
 	"github.com/isacikgoz/promptui"
 	"github.com/isacikgoz/promptui/screenbuf"
-
-	log "github.com/sirupsen/logrus"
 )
 
 type BranchOptions struct {
-	Types     BranchTypes
-	PromptOps *PromptOptions
+	Types       BranchTypes
+	Sort        BranchSort
+	Base        string
+	MergeFilter MergeFilter
+	// Cleanup lists stale branches to delete them in bulk
+	Cleanup      bool
+	InactiveDays int
+	PromptOps    *PromptOptions
+
+	// err is shown in the label when the prompt is built again
+	err error
 }
 
 type BranchTypes uint8
@@ -25,36 +36,141 @@ const (
 	AllBranches
 )
 
+// BranchSort is the order of the branch list
+type BranchSort uint8
+
+const (
+	// SortNone keeps the order of the refs
+	SortNone BranchSort = iota
+	SortName
+	SortDate
+	SortAhead
+	SortBehind
+)
+
+var branchSortNames = []string{"none", "name", "date", "ahead", "behind"}
+
+func (s BranchSort) String() string {
+	return branchSortNames[s]
+}
+
+// ParseBranchSort returns the sort with the given name, SortNone if there
+// is no such sort
+func ParseBranchSort(name string) BranchSort {
+	for i, n := range branchSortNames {
+		if n == name {
+			return BranchSort(i)
+		}
+	}
+	return SortNone
+}
+
+// MergeFilter limits the branches by whether they are merged into the base
+type MergeFilter uint8
+
+const (
+	NoMergeFilter MergeFilter = iota
+	MergedBranches
+	UnmergedBranches
+)
+
 func BranchBuilder(r *git.Repository, opts *BranchOptions) error {
+	if opts.Cleanup {
+		return cleanupPrompt(r, opts)
+	}
+	if err := loadBranches(r, opts); err != nil {
+		return err
+	}
+	if len(r.Branches) == 0 {
+		if r.Head.State == git.HeadUnborn {
+			return git.ErrUnbornHead
+		}
+		return errors.New("there are no branches to list")
+	}
+	return branchPrompt(r, opts)
+}
+
+// loadBranches loads the branches, keeps only the requested ones and sorts
+// them
+func loadBranches(r *git.Repository, opts *BranchOptions) error {
 	if err := r.InitializeBranches(); err != nil {
 		return err
 	}
-	switch opts.Types {
-	case LocalBranches:
-		i := 0 // output index
-		for _, b := range r.Branches {
-			if !b.IsRemote() {
-				r.Branches[i] = b
-				i++
-			}
+	var base *git.Branch
+	if opts.MergeFilter != NoMergeFilter {
+		b, err := baseBranch(r, opts.Base)
+		if err != nil {
+			return err
+		}
+		base = b
+	}
+	i := 0 // output index
+	for _, b := range r.Branches {
+		if opts.Types == LocalBranches && b.IsRemote() {
+			continue
+		}
+		if opts.Types == RemoteBranches && !b.IsRemote() {
+			continue
 		}
-		r.Branches = r.Branches[:i]
-	case RemoteBranches:
-		i := 0 // output index
-		for _, b := range r.Branches {
-			if b.IsRemote() {
-				r.Branches[i] = b
-				i++
+		if base != nil {
+			merged, err := r.IsMerged(b, base)
+			if err != nil {
+				return err
+			}
+			if merged != (opts.MergeFilter == MergedBranches) {
+				continue
 			}
 		}
-		r.Branches = r.Branches[:i]
-	case AllBranches:
+		r.Branches[i] = b
+		i++
+	}
+	r.Branches = r.Branches[:i]
+	sortBranches(r.Branches, opts.Sort)
+	return nil
+}
+
+// baseBranch returns the named branch, or HEAD if the name is empty. A
+// detached HEAD is given as a branch named HEAD so that it can be compared.
+func baseBranch(r *git.Repository, name string) (*git.Branch, error) {
+	if len(name) > 0 {
+		return r.FindBranch(name)
+	}
+	switch {
+	case r.Branch != nil:
+		return r.Branch, nil
+	case r.Head.State == git.HeadUnborn:
+		return nil, git.ErrUnbornHead
+	case r.Head.State == git.HeadDetached:
+		return &git.Branch{
+			Name:     "HEAD",
+			FullName: "HEAD",
+			Hash:     r.Head.Hash,
+		}, nil
+	}
+	return nil, errors.New("there is no base branch, use --base to set one")
+}
 
+func sortBranches(branches []*git.Branch, by BranchSort) {
+	var less func(a, b *git.Branch) bool
+	switch by {
+	case SortName:
+		less = func(a, b *git.Branch) bool { return a.Name < b.Name }
+	case SortDate:
+		less = func(a, b *git.Branch) bool { return a.LastCommitTime().After(b.LastCommitTime()) }
+	case SortAhead:
+		less = func(a, b *git.Branch) bool { return len(a.Ahead) > len(b.Ahead) }
+	case SortBehind:
+		less = func(a, b *git.Branch) bool { return len(a.Behind) > len(b.Behind) }
+	default:
+		return
 	}
-	return branchPrompt(r, opts.PromptOps)
+	sort.SliceStable(branches, func(i, j int) bool {
+		return less(branches[i], branches[j])
+	})
 }
 
-func branchPrompt(r *git.Repository, opts *PromptOptions) error {
+func branchPrompt(r *git.Repository, opts *BranchOptions) error {
+	promptOps := opts.PromptOps
 
 	// make terminal not line wrap
 	fmt.Printf("\x1b[?7l")
@@ -62,6 +178,43 @@ func branchPrompt(r *git.Repository, opts *PromptOptions) error {
 	defer fmt.Printf("\x1b[?7h")
 
 	var prompt promptui.Select
+	stop := false
+	rows := branchRows(r.Branches)
+	// rowsMu guards the rows while the watcher replaces them, the handlers
+	// read the rows instead of r.Branches which is filtered in place
+	var rowsMu sync.Mutex
+	// stopWatch is set once the prompt is ready to be refreshed
+	stopWatch := func() {}
+	// reload is called with promptMu held
+	reload := func(index int, err error) error {
+		if err := loadBranches(r, opts); err != nil {
+			return err
+		}
+		loaded := branchRows(r.Branches)
+		rowsMu.Lock()
+		rows = loaded
+		rowsMu.Unlock()
+		prompt.Label = branchLabel(opts, err)
+		prompt.RefreshList(loaded, clampIndex(index, len(loaded)))
+		return nil
+	}
+	// branchAt returns the branch at the index, it is nil if a reload
+	// emptied the list
+	branchAt := func(index int) *git.Branch {
+		rowsMu.Lock()
+		defer rowsMu.Unlock()
+		if index < 0 || index >= len(rows) {
+			return nil
+		}
+		return rows[index].Branch
+	}
+	searcher := func(input string, index int) bool {
+		b := branchAt(index)
+		if b == nil {
+			return false
+		}
+		return fuzzyMatch(input, b.Name)
+	}
 	kset := make(map[rune]promptui.CustomFunc)
 	kset['q'] = func(in interface{}, chb chan bool, index int) error {
 		chb <- true
@@ -69,52 +222,261 @@ func branchPrompt(r *git.Repository, opts *PromptOptions) error {
 		return nil
 	}
 	kset['d'] = func(in interface{}, chb chan bool, index int) error {
-		screenbuf.Clear(os.Stdin)
-		b := r.Branches[index]
-		if b == r.Branch {
+		b := branchAt(index)
+		if b == nil || b.IsRemote() {
 			return nil
 		}
-		cmd := exec.Command("git", "branch", "-d", b.Name)
-		if err := cmd.Run(); err == nil {
-			log.Error(err)
-		}
-		chb <- false
-		if err := r.InitializeBranches(); err != nil {
+		stopWatch()
+		chb <- true
+		stop = true
+		screenbuf.Clear(os.Stdin)
+		opts.err = deleteBranchPrompt(r, b)
+		if err := loadBranches(r, opts); err != nil {
 			return err
 		}
-		prompt.RefreshList(r.Branches, index)
-		return nil
+		return branchPrompt(r, opts)
+	}
+	kset['s'] = func(in interface{}, chb chan bool, index int) error {
+		promptMu.Lock()
+		defer promptMu.Unlock()
+		opts.Sort = (opts.Sort + 1) % BranchSort(len(branchSortNames))
+		chb <- false
+		return reload(0, nil)
+	}
+	kset['m'] = func(in interface{}, chb chan bool, index int) error {
+		promptMu.Lock()
+		defer promptMu.Unlock()
+		opts.MergeFilter = (opts.MergeFilter + 1) % 3
+		chb <- false
+		return reload(0, nil)
+	}
+	kset['u'] = func(in interface{}, chb chan bool, index int) error {
+		promptMu.Lock()
+		defer promptMu.Unlock()
+		_, err := r.Undo()
+		chb <- false
+		return reload(index, err)
+	}
+	kset['U'] = func(in interface{}, chb chan bool, index int) error {
+		promptMu.Lock()
+		defer promptMu.Unlock()
+		_, err := r.Redo()
+		chb <- false
+		return reload(index, err)
 	}
 
 	prompt = promptui.Select{
-		Label:       "Branches",
-		Items:       r.Branches,
-		HideHelp:    opts.HideHelp,
-		Size:        opts.Size,
+		Label:       branchLabel(opts, opts.err),
+		Items:       rows,
+		HideHelp:    promptOps.HideHelp,
+		Size:        promptOps.Size,
+		Searcher:    searcher,
 		Templates:   branchTemplate(),
 		CustomFuncs: kset,
 	}
-	i, _, err := prompt.RunCursorAt(opts.Cursor, opts.Scroll)
+	opts.err = nil
+	// the list is reloaded when the refs are changed outside of gitin
+	stopWatch = watchPrompt(r, func() {
+		reload(prompt.CursorPosition(), nil)
+	})
+	i, _, err := prompt.RunCursorAt(promptOps.Cursor, promptOps.Scroll)
+	stopWatch()
+
+	if stop {
+		return nil
+	}
 
-	if err == nil {
+	if b := branchAt(i); err == nil && b != nil {
 		screenbuf.Clear(os.Stdin)
-		cmd := exec.Command("git", "checkout", r.Branches[i].Name)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		cmd.Stdin = os.Stdin
-		return cmd.Run()
+		return checkoutPrompt(r, b, promptOps)
 	}
 
 	return screenbuf.Clear(os.Stdin)
 }
 
+// checkoutPrompt switches to the branch, if there are local changes it
+// asks whether to carry them over or to stash them
+func checkoutPrompt(r *git.Repository, b *git.Branch, opts *PromptOptions) error {
+	if r.IsBare() {
+		return git.ErrBareRepository
+	}
+	if b.IsRemote() {
+		local, err := trackingBranchPrompt(r, b, opts)
+		if err != nil || local == nil {
+			return err
+		}
+		b = local
+	}
+	if r.Branch != nil && r.Branch.Name == b.Name {
+		fmt.Println("Already on " + b.Name)
+		return nil
+	}
+	mode := git.CheckoutCarry
+	if len(r.Status.Entries) > 0 {
+		err := r.CheckoutConflicts(b)
+		conflict, isConflict := err.(*git.ConflictError)
+		if err != nil && !isConflict {
+			return err
+		}
+		items := []string{"Carry local changes over", "Stash local changes, switch and apply them back"}
+		label := "There are local changes"
+		if isConflict {
+			fmt.Println(conflict.Error() + ":")
+			for _, p := range conflict.Paths {
+				fmt.Println("  " + p)
+			}
+			items = items[1:]
+			label = "Local changes conflict with " + b.Name
+		}
+		prompt := promptui.Select{
+			Label:     label,
+			Items:     items,
+			HideHelp:  opts.HideHelp,
+			Size:      opts.Size,
+			Templates: stringsTemplate(),
+		}
+		i, _, err := prompt.RunCursorAt(0, 0)
+		if err != nil {
+			return nil
+		}
+		if items[i] != "Carry local changes over" {
+			mode = git.CheckoutStash
+		}
+	}
+	result, err := r.Checkout(b, mode)
+	if err != nil {
+		return err
+	}
+	yellow := color.New(color.FgYellow)
+	fmt.Println(strings.Replace(result.String(), b.Name, yellow.Sprint(b.Name), 1))
+	return nil
+}
+
+// trackingBranchPrompt returns the local branch to switch to instead of the
+// remote branch, it is created if it doesn't exist. If the local branch
+// points elsewhere the user decides to reuse or to reset it.
+func trackingBranchPrompt(r *git.Repository, remote *git.Branch, opts *PromptOptions) (*git.Branch, error) {
+	local, err := r.LocalBranchFor(remote)
+	if err != nil {
+		return nil, err
+	}
+	if local == nil {
+		return r.CreateTrackingBranch(remote, false)
+	}
+	if local.Hash == remote.Hash {
+		return local, nil
+	}
+	reuse := "Switch to " + local.Name + " as it is"
+	items := []string{reuse, "Reset " + local.Name + " to " + remote.Name}
+	prompt := promptui.Select{
+		Label:     "Local branch " + local.Name + " points to another commit",
+		Items:     items,
+		HideHelp:  opts.HideHelp,
+		Size:      opts.Size,
+		Templates: stringsTemplate(),
+	}
+	i, _, err := prompt.RunCursorAt(0, 0)
+	if err != nil {
+		return nil, nil
+	}
+	if items[i] == reuse {
+		return local, nil
+	}
+	return r.CreateTrackingBranch(remote, true)
+}
+
+// deleteBranchPrompt asks before deleting the branch, if the branch is not
+// merged the commits that would be lost are shown and force is offered
+func deleteBranchPrompt(r *git.Repository, b *git.Branch) error {
+	if !confirm("Delete branch " + b.Name) {
+		return nil
+	}
+	err := r.DeleteBranch(b, false)
+	unmerged, ok := err.(*git.UnmergedError)
+	if !ok {
+		return err
+	}
+	_, err = forceDeletePrompt(r, b, unmerged)
+	return err
+}
+
+// forceDeletePrompt shows the commits that would be lost by deleting the
+// unmerged branch and deletes it with force if the user confirms
+func forceDeletePrompt(r *git.Repository, b *git.Branch, unmerged *git.UnmergedError) (bool, error) {
+	yellow := color.New(color.FgYellow)
+	fmt.Println(unmerged.Error() + ", these commits would be lost:")
+	for _, c := range unmerged.Commits {
+		if c == nil {
+			continue
+		}
+		fmt.Println("  " + yellow.Sprint(c.Hash[:7]) + " " + c.Summary)
+	}
+	if !confirm("Force delete branch " + b.Name) {
+		return false, nil
+	}
+	return true, r.DeleteBranch(b, true)
+}
+
+// branchLabel shows the sort, the merge filter and the error of the last
+// action next to the label
+func branchLabel(opts *BranchOptions, err error) string {
+	label := "Branches"
+	if opts.Sort != SortNone {
+		label = label + " [sort: " + opts.Sort.String() + "]"
+	}
+	base := opts.Base
+	if len(base) == 0 {
+		base = "HEAD"
+	}
+	switch opts.MergeFilter {
+	case MergedBranches:
+		label = label + " [merged into " + base + "]"
+	case UnmergedBranches:
+		label = label + " [not merged into " + base + "]"
+	}
+	if err != nil {
+		label = label + " (" + err.Error() + ")"
+	}
+	return label
+}
+
+// branchRow is a branch in the list, its name is padded to the longest name
+// of the list so that the columns line up
+type branchRow struct {
+	*git.Branch
+	width int
+}
+
+// branchRows wraps the branches, the widths are computed again whenever the
+// list is reloaded
+func branchRows(branches []*git.Branch) []*branchRow {
+	width := 0
+	for _, b := range branches {
+		if len(b.Name) > width {
+			width = len(b.Name)
+		}
+	}
+	rows := make([]*branchRow, len(branches))
+	for i, b := range branches {
+		rows[i] = &branchRow{Branch: b, width: width}
+	}
+	return rows
+}
+
+// PaddedName returns the name padded to the width of the list
+func (b *branchRow) PaddedName() string {
+	return fmt.Sprintf("%-*s", b.width, b.Name)
+}
+
 func branchTemplate() *promptui.SelectTemplates {
+	name := ".PaddedName"
+	columns := " {{ printf \"%-9s\" .AheadBehind | yellow }} {{ .LastCommitSince | faint }}"
 	templates := &promptui.SelectTemplates{
 		Label:    "{{ . |yellow}}:",
-		Active:   "*  {{ .Name | green }}",
-		Inactive: "   {{ .Name }}",
+		Active:   "*  {{ " + name + " | green }}" + columns,
+		Inactive: "   {{ " + name + " }}" + columns,
 		Selected: "{{ .Name }}",
-		Extra:    "delete: d checkout: enter",
+		Extra:    "delete: d checkout: enter sort: s merged: m undo/redo: u/U",
 		Details: "\n" +
 			"-------------- Last Commit --------------" + "\n" +
 			"{{ \"Hash:\"  | faint }}    {{ .Hash | yellow }} " + "\n" +
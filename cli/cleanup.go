@@ -0,0 +1,156 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/isacikgoz/gitin/git"
+	"github.com/isacikgoz/promptui"
+	"github.com/isacikgoz/promptui/screenbuf"
+)
+
+// cleanupRow is a stale branch in the cleanup list
+type cleanupRow struct {
+	*git.StaleBranch
+	Selected bool
+}
+
+// cleanupPrompt lists the stale branches, lets the user pick some of them
+// and deletes the picked ones
+func cleanupPrompt(r *git.Repository, opts *BranchOptions) error {
+	if err := r.InitializeBranches(); err != nil {
+		return err
+	}
+	base, err := baseBranch(r, opts.Base)
+	if err != nil {
+		return err
+	}
+	inactive := time.Duration(opts.InactiveDays) * 24 * time.Hour
+	stale, err := r.StaleBranches(base, inactive)
+	if err != nil {
+		return err
+	}
+	if len(stale) == 0 {
+		fmt.Println("There are no stale branches")
+		return nil
+	}
+	rows := make([]*cleanupRow, 0)
+	for _, s := range stale {
+		// inactive branches and the ones with a deleted upstream may still
+		// have unmerged work, so only the merged ones are picked initially
+		rows = append(rows, &cleanupRow{
+			StaleBranch: s,
+			Selected:    s.Reasons&git.StaleMerged != 0,
+		})
+	}
+
+	// make terminal not line wrap
+	fmt.Printf("\x1b[?7l")
+	// defer restoring line wrap
+	defer fmt.Printf("\x1b[?7h")
+
+	var prompt promptui.Select
+	kset := make(map[rune]promptui.CustomFunc)
+	kset['q'] = func(in interface{}, chb chan bool, index int) error {
+		chb <- true
+		defer os.Exit(0)
+		return nil
+	}
+	kset[' '] = func(in interface{}, chb chan bool, index int) error {
+		rows[index].Selected = !rows[index].Selected
+		chb <- false
+		prompt.RefreshList(rows, index)
+		return nil
+	}
+	kset['a'] = func(in interface{}, chb chan bool, index int) error {
+		all := true
+		for _, row := range rows {
+			all = all && row.Selected
+		}
+		for _, row := range rows {
+			row.Selected = !all
+		}
+		chb <- false
+		prompt.RefreshList(rows, index)
+		return nil
+	}
+	prompt = promptui.Select{
+		Label:       "Stale branches (base: " + base.Name + ")",
+		Items:       rows,
+		HideHelp:    opts.PromptOps.HideHelp,
+		Size:        opts.PromptOps.Size,
+		Templates:   cleanupTemplate(),
+		CustomFuncs: kset,
+	}
+	if _, _, err := prompt.RunCursorAt(opts.PromptOps.Cursor, opts.PromptOps.Scroll); err != nil {
+		return screenbuf.Clear(os.Stdin)
+	}
+	screenbuf.Clear(os.Stdin)
+
+	selected := make([]*git.Branch, 0)
+	for _, row := range rows {
+		if row.Selected {
+			selected = append(selected, row.Branch)
+		}
+	}
+	if len(selected) == 0 {
+		fmt.Println("No branches are selected")
+		return nil
+	}
+	if !confirm("Delete " + strconv.Itoa(len(selected)) + " branch(es)") {
+		return nil
+	}
+	return deleteBranches(r, selected)
+}
+
+// deleteBranches deletes the branches and prints what is deleted and how
+// to bring them back, an unmerged branch is deleted only if the user
+// confirms it after seeing the commits that would be lost
+func deleteBranches(r *git.Repository, branches []*git.Branch) error {
+	yellow := color.New(color.FgYellow)
+	red := color.New(color.FgRed)
+	deleted := make([]*git.Branch, 0)
+	for _, b := range branches {
+		err := r.DeleteBranch(b, false)
+		if unmerged, ok := err.(*git.UnmergedError); ok {
+			var forced bool
+			if forced, err = forceDeletePrompt(r, b, unmerged); err == nil && !forced {
+				fmt.Println("Kept " + b.Name)
+				continue
+			}
+		}
+		if err != nil {
+			fmt.Println(red.Sprint("Failed") + " to delete " + b.Name + ": " + err.Error())
+			continue
+		}
+		fmt.Println("Deleted " + b.Name + " (was " + yellow.Sprint(b.Hash[:7]) + ")")
+		deleted = append(deleted, b)
+	}
+	if len(deleted) == 0 {
+		return nil
+	}
+	fmt.Println("\n" + strconv.Itoa(len(deleted)) + " of " + strconv.Itoa(len(branches)) + " branch(es) deleted.")
+	fmt.Println("To restore a branch run \"git branch <name> <hash>\" with the hash above,")
+	fmt.Println("the commits can also be found with \"git reflog\" until they expire.")
+	return nil
+}
+
+func cleanupTemplate() *promptui.SelectTemplates {
+	templates := &promptui.SelectTemplates{
+		Label:    "{{ . |yellow}}:",
+		Active:   "* {{ if .Selected }}[x]{{ else }}[ ]{{ end }} {{ .Branch.Name | green }} {{ .Reasons | faint }}",
+		Inactive: "  {{ if .Selected }}[x]{{ else }}[ ]{{ end }} {{ .Branch.Name }} {{ .Reasons | faint }}",
+		Selected: "{{ .Branch.Name }}",
+		Extra:    "pick: space all: a delete: enter",
+		Details: "\n" +
+			"-------------- Last Commit --------------" + "\n" +
+			"{{ \"Hash:\"  | faint }}    {{ .Branch.Hash | yellow }} " + "\n" +
+			"{{ \"Message:\"  | faint }} {{ .Branch.LastCommitMessage }} " + "\n" +
+			"{{ \"Author:\"  | faint }}  {{ .Branch.LastCommitAuthor }} " + "\n" +
+			"{{ \"Date:\"  | faint }}    {{ .Branch.LastCommitDate }} ({{ .Branch.LastCommitSince | blue }})",
+	}
+	return templates
+}
@@ -28,13 +28,17 @@ func commitPrompt(r *git.Repository, opts *CommitOptions) error {
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	cmd.Stdin = os.Stdin
-	ok := false
-	if err := cmd.Start(); err != nil {
-		return err
-	}
-	if err := cmd.Wait(); err == nil {
-		ok = true
+	var startErr error
+	err := r.Record("commit", []string{"HEAD"}, func() error {
+		if startErr = cmd.Start(); startErr != nil {
+			return startErr
+		}
+		return cmd.Wait()
+	})
+	if startErr != nil {
+		return startErr
 	}
+	ok := err == nil
 	if err := r.InitializeStatus(); err != nil {
 		return err
 	}
@@ -51,13 +55,17 @@ func commitAmend(r *git.Repository) error {
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	cmd.Stdin = os.Stdin
-	ok := false
-	if err := cmd.Start(); err != nil {
-		return err
-	}
-	if err := cmd.Wait(); err == nil {
-		ok = true
+	var startErr error
+	err := r.Record("amend", []string{"HEAD"}, func() error {
+		if startErr = cmd.Start(); startErr != nil {
+			return startErr
+		}
+		return cmd.Wait()
+	})
+	if startErr != nil {
+		return startErr
 	}
+	ok := err == nil
 	if err := r.InitializeStatus(); err != nil {
 		return err
 	}
@@ -0,0 +1,16 @@
+package cli
+
+import (
+	"github.com/isacikgoz/promptui"
+)
+
+// confirm asks a yes/no question and returns the answer, anything other
+// than yes is a no
+func confirm(label string) bool {
+	prompt := promptui.Prompt{
+		Label:     label,
+		IsConfirm: true,
+	}
+	_, err := prompt.Run()
+	return err == nil
+}
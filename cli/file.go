@@ -0,0 +1,125 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/isacikgoz/gitin/git"
+	"github.com/isacikgoz/promptui"
+	"github.com/isacikgoz/promptui/screenbuf"
+)
+
+// fileAction is an item of the file prompt
+type fileAction struct {
+	Name string
+	run  func() (string, error)
+}
+
+func (a *fileAction) String() string {
+	return a.Name
+}
+
+// filePrompt lets the user read, save or restore the file of the delta as it
+// is in the commit and in its parent. The prompt is shown until the user
+// quits, the result of the last action is shown next to the label.
+func filePrompt(r *git.Repository, c *git.Commit, d *git.DiffDelta, opts *PromptOptions) error {
+	short := c.Hash[:7]
+	parent := "parent"
+	if len(c.Parents) > 0 {
+		parent = c.Parents[0][:7]
+	}
+	view := func(old bool) func() (string, error) {
+		return func() (string, error) {
+			v, err := fileVersionOf(r, c, d, old)
+			if err != nil {
+				return "", err
+			}
+			screenbuf.Clear(os.Stdin)
+			popMore(v.String())
+			return "", nil
+		}
+	}
+	save := func(old bool) func() (string, error) {
+		return func() (string, error) {
+			v, err := fileVersionOf(r, c, d, old)
+			if err != nil {
+				return "", err
+			}
+			prompt := promptui.Prompt{
+				Label:   "Save as",
+				Default: filepath.Base(v.Path) + "@" + v.Commit[:7],
+			}
+			path, err := prompt.Run()
+			if err != nil {
+				return "", nil
+			}
+			if err := v.Save(path); err != nil {
+				return "", err
+			}
+			return "saved to " + path, nil
+		}
+	}
+	restore := func(old, index bool) func() (string, error) {
+		return func() (string, error) {
+			v, err := fileVersionOf(r, c, d, old)
+			if err != nil {
+				return "", err
+			}
+			if !confirm("Overwrite " + v.Path + " in the working tree, it can't be undone") {
+				return "", nil
+			}
+			if err := r.RestoreFile(v, index); err != nil {
+				return "", err
+			}
+			if index {
+				return "restored " + v.Path + " and staged it", nil
+			}
+			return "restored " + v.Path, nil
+		}
+	}
+	actions := []*fileAction{
+		{Name: "View at " + short, run: view(false)},
+		{Name: "View at " + parent, run: view(true)},
+		{Name: "Save the version at " + short, run: save(false)},
+		{Name: "Save the version at " + parent, run: save(true)},
+	}
+	if !r.IsBare() {
+		actions = append(actions,
+			&fileAction{Name: "Restore the version at " + short + " to the working tree", run: restore(false, false)},
+			&fileAction{Name: "Restore the version at " + short + " to the working tree and the index", run: restore(false, true)},
+			&fileAction{Name: "Restore the version at " + parent + " to the working tree", run: restore(true, false)},
+			&fileAction{Name: "Restore the version at " + parent + " to the working tree and the index", run: restore(true, true)},
+		)
+	}
+	label := d.String()
+	cursor := 0
+	for {
+		prompt := promptui.Select{
+			Label:     label,
+			Items:     actions,
+			HideHelp:  opts.HideHelp,
+			Size:      opts.Size,
+			Templates: stringsTemplate(),
+		}
+		i, _, err := prompt.RunCursorAt(cursor, 0)
+		if err != nil {
+			return nil
+		}
+		cursor = i
+		msg, err := actions[i].run()
+		label = d.String()
+		if err != nil {
+			label = label + " (" + err.Error() + ")"
+		} else if len(msg) > 0 {
+			label = label + " (" + msg + ")"
+		}
+	}
+}
+
+// fileVersionOf reads the file of the delta in the commit or in its parent
+func fileVersionOf(r *git.Repository, c *git.Commit, d *git.DiffDelta, old bool) (*git.FileVersion, error) {
+	if old {
+		return r.OldFileVersion(c, d)
+	}
+	return r.NewFileVersion(c, d)
+}
@@ -0,0 +1,187 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+
+	"github.com/isacikgoz/gitin/git"
+	"github.com/isacikgoz/promptui"
+	"github.com/isacikgoz/promptui/screenbuf"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// GrepOptions is the options of the grep command
+type GrepOptions struct {
+	Pattern    string
+	Revision   string
+	Pathspecs  []string
+	IgnoreCase bool
+	PromptOps  *PromptOptions
+}
+
+// GrepBuilder searches the working dir or the revision and lists the
+// matching lines
+func GrepBuilder(r *git.Repository, opts *GrepOptions) error {
+	pattern := opts.Pattern
+	if opts.IgnoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return err
+	}
+	pathspecs := opts.Pathspecs
+	var c *git.Commit
+	if len(opts.Revision) > 0 {
+		// like git, an argument that is not a revision is a pathspec
+		if c, err = r.ResolveRevision(opts.Revision); err != nil {
+			c = nil
+			pathspecs = append([]string{opts.Revision}, pathspecs...)
+		}
+	}
+	if c == nil && r.IsBare() {
+		if c, err = r.ResolveRevision("HEAD"); err != nil {
+			return err
+		}
+	}
+	matches, err := r.Grep(re, c, pathspecs)
+	if err != nil {
+		return err
+	}
+	if len(matches) == 0 {
+		return errors.New("there are no matches for " + opts.Pattern)
+	}
+	return grepPrompt(r, matches, opts.PromptOps)
+}
+
+// grepPrompt lists the matches, enter opens the file at the line and b
+// opens the blame of the file at the line
+func grepPrompt(r *git.Repository, matches []*git.GrepMatch, opts *PromptOptions) error {
+	// make terminal not line wrap
+	fmt.Printf("\x1b[?7l")
+	// defer restoring line wrap
+	defer fmt.Printf("\x1b[?7h")
+
+	var prompt promptui.Select
+	stop := false
+	var recursed error
+	again := func() error {
+		o := &PromptOptions{
+			Cursor:   prompt.CursorPosition(),
+			Scroll:   prompt.ScrollPosition(),
+			Size:     opts.Size,
+			HideHelp: opts.HideHelp,
+		}
+		recursed = grepPrompt(r, matches, o)
+		return recursed
+	}
+	searcher := func(input string, index int) bool {
+		return fuzzyMatch(input, matches[index].String())
+	}
+	kset := make(map[rune]promptui.CustomFunc)
+	kset['q'] = func(in interface{}, chb chan bool, index int) error {
+		chb <- true
+		defer os.Exit(0)
+		return nil
+	}
+	kset['b'] = func(in interface{}, chb chan bool, index int) error {
+		m := matches[index]
+		if m.Binary {
+			return nil
+		}
+		args := []string{"blame"}
+		if len(m.Revision) > 0 {
+			args = append(args, m.Revision)
+		}
+		out, err := exec.Command("git", append(args, "--", m.Path)...).Output()
+		if err != nil {
+			return err
+		}
+		screenbuf.Clear(os.Stdin)
+		popLessAt(string(out), m.Line)
+		chb <- true
+		stop = true
+		return again()
+	}
+
+	prompt = promptui.Select{
+		Label:       strconv.Itoa(len(matches)) + " match(es)",
+		Items:       matches,
+		HideHelp:    opts.HideHelp,
+		Size:        opts.Size,
+		Searcher:    searcher,
+		Templates:   grepTemplate(),
+		CustomFuncs: kset,
+	}
+	i, _, err := prompt.RunCursorAt(opts.Cursor, opts.Scroll)
+	if stop {
+		return recursed
+	}
+	if err != nil {
+		return screenbuf.Clear(os.Stdin)
+	}
+	m := matches[i]
+	if !m.Binary {
+		content, err := r.GrepContent(m)
+		if err != nil {
+			return err
+		}
+		screenbuf.Clear(os.Stdin)
+		popLessAt(content, m.Line)
+	}
+	return grepPrompt(r, matches, &PromptOptions{
+		Cursor:   prompt.CursorPosition(),
+		Scroll:   prompt.ScrollPosition(),
+		Size:     opts.Size,
+		HideHelp: opts.HideHelp,
+	})
+}
+
+// popLessAt shows the text in the pager with line numbers, starting from
+// the line
+func popLessAt(in string, line int) error {
+	os.Setenv("LESS", "-RC")
+	args := []string{"-N"}
+	if line > 0 {
+		// keep a few lines of context above the line
+		args = append(args, "+"+strconv.Itoa(line)+"g", "-j5")
+	}
+	cmd := exec.Command("less", args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		log.Fatal(err)
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	go func() {
+		defer stdin.Close()
+		io.WriteString(stdin, in)
+	}()
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	return cmd.Wait()
+}
+
+func grepTemplate() *promptui.SelectTemplates {
+	templates := &promptui.SelectTemplates{
+		Label:    "{{ . |yellow}}:",
+		Active:   "* {{ if .Binary }}{{ .String | green }}{{ else }}{{ .Path | green }}:{{ .Line | yellow }}: {{ .Text }}{{ end }}",
+		Inactive: "  {{ if .Binary }}{{ .String }}{{ else }}{{ .Path | cyan }}:{{ .Line | yellow }}: {{ .Text }}{{ end }}",
+		Selected: "{{ .String }}",
+		Extra:    "open: enter blame: b",
+		Details: "\n" +
+			"---------------- Match -----------------" + "\n" +
+			"{{ \"File:\" | faint }} {{ .Path }}" + "\n" +
+			"{{- if .Revision }}" + "\n" +
+			"{{ \"At:\"   | faint }}   {{ .Revision | yellow }}" +
+			"{{- end }}",
+	}
+	return templates
+}
@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"os"
+
+	"github.com/isacikgoz/gitin/git"
+	"github.com/isacikgoz/promptui"
+	"github.com/isacikgoz/promptui/screenbuf"
+)
+
+// ignorePrompt asks for a pattern that matches the entry and the file to
+// write it, then adds the rule
+func ignorePrompt(r *git.Repository, e *git.StatusEntry, opts *PromptOptions) error {
+	screenbuf.Clear(os.Stdin)
+	patterns := e.IgnorePatterns()
+	prompt := promptui.Select{
+		Label:     "Ignore " + e.Path(),
+		Items:     patterns,
+		HideHelp:  opts.HideHelp,
+		Size:      opts.Size,
+		Templates: stringsTemplate(),
+	}
+	i, _, err := prompt.RunCursorAt(0, 0)
+	if err != nil {
+		return err
+	}
+	prompt = promptui.Select{
+		Label:     "Add " + patterns[i] + " to",
+		Items:     git.IgnoreTargets,
+		HideHelp:  opts.HideHelp,
+		Size:      opts.Size,
+		Templates: stringsTemplate(),
+	}
+	j, _, err := prompt.RunCursorAt(0, 0)
+	if err != nil {
+		return err
+	}
+	return r.Ignore(patterns[i], git.IgnoreTargets[j])
+}
+
+// explainIgnore describes why the entry is ignored
+func explainIgnore(r *git.Repository, e *git.StatusEntry) error {
+	match, err := r.ExplainIgnore(e.Path())
+	if err != nil {
+		return err
+	}
+	return popMore(e.Path() + " is ignored by\n\n" + match.String() + "\n")
+}
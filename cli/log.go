@@ -4,7 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
-	"strings"
+	"strconv"
 
 	"github.com/isacikgoz/gitin/git"
 	"github.com/isacikgoz/promptui"
@@ -19,6 +19,8 @@ type LogOptions struct {
 	MaxCount  int
 	Tags      bool
 	Since     string
+	Pickaxe   string
+	Regex     string
 
 	PromptOps *PromptOptions
 }
@@ -34,17 +36,24 @@ const (
 func LogBuilder(r *git.Repository, opts *LogOptions) error {
 	var commits []*git.Commit
 	loadOpts := &git.CommitLoadOptions{
-		MaxCount:  opts.MaxCount,
-		Author:    opts.Author,
-		Committer: opts.Committer,
-		Since:     opts.Since,
-		Before:    opts.Before,
+		MaxCount:     opts.MaxCount,
+		Author:       opts.Author,
+		Committer:    opts.Committer,
+		Since:        opts.Since,
+		Before:       opts.Before,
+		Pickaxe:      opts.Pickaxe,
+		PickaxeRegex: opts.Regex,
 	}
 	if opts.Tags {
 		if err := r.InitializeTags(); err != nil {
 			return err
 		}
 	}
+	// the ahead and behind commits are compared with the upstream, they are
+	// not searched by their changes
+	if opts.Mode != LogNormal && (len(opts.Pickaxe) > 0 || len(opts.Regex) > 0) {
+		return errors.New("-S and -G can only be used with the whole log")
+	}
 
 	switch opts.Mode {
 	case LogNormal:
@@ -53,40 +62,95 @@ func LogBuilder(r *git.Repository, opts *LogOptions) error {
 		}
 		commits = r.Commits
 	case LogAhead:
-		if err := r.InitializeBranches(); err != nil {
+		b, err := currentBranch(r)
+		if err != nil {
 			return err
 		}
-		commits = r.Branch.Ahead
+		commits = b.Ahead
 	case LogBehind:
-		if err := r.InitializeBranches(); err != nil {
+		b, err := currentBranch(r)
+		if err != nil {
 			return err
 		}
-		commits = r.Branch.Behind
+		commits = b.Behind
 	case LogMixed:
-		if err := r.InitializeBranches(); err != nil {
+		b, err := currentBranch(r)
+		if err != nil {
 			return err
 		}
 		if err := r.InitializeCommits(loadOpts); err != nil {
 			return err
 		}
-		commits = r.Branch.Ahead
+		commits = b.Ahead
 		commits = append(commits, r.Commits...)
 	}
 	return logPrompt(r, opts.PromptOps, commits)
 }
 
+// currentBranch loads the branches and returns the checked out one, ahead
+// and behind commits are meaningless when HEAD is not on a branch
+func currentBranch(r *git.Repository) (*git.Branch, error) {
+	if err := r.InitializeBranches(); err != nil {
+		return nil, err
+	}
+	if r.Branch != nil {
+		return r.Branch, nil
+	}
+	if r.Head.State == git.HeadUnborn {
+		return nil, git.ErrUnbornHead
+	}
+	return nil, errors.New(r.Head.String() + ", there is no upstream to compare")
+}
+
+// logRow is a commit in the log prompt, marked commits are exported
+type logRow struct {
+	*git.Commit
+	Marked bool
+	// Highlighted is the summary with the runes matching the search
+	// highlighted, it is empty if there is no search
+	Highlighted string
+}
+
+// logView is the state of the log prompt that is kept between recursions
+type logView struct {
+	rows  []*logRow
+	query string
+	// decorated is set once the tags and the branches of the rows are
+	// loaded for a "#name" search
+	decorated bool
+}
+
+// visible returns the rows that match the query, best matches first
+func (v *logView) visible() []*logRow {
+	return rankLogRows(v.rows, v.query)
+}
+
 func logPrompt(r *git.Repository, opts *PromptOptions, commits []*git.Commit) error {
 	if len(commits) <= 0 {
 		return errors.New("there are no commits to log")
 	}
-	searcher := func(input string, index int) bool {
-		item := commits[index]
-		name := strings.Replace(strings.ToLower(item.Message), " ", "", -1)
-		input = strings.Replace(strings.ToLower(input), " ", "", -1)
+	rows := make([]*logRow, 0)
+	for _, c := range commits {
+		rows = append(rows, &logRow{Commit: c})
+	}
+	return logRowsPrompt(r, opts, &logView{rows: rows})
+}
 
-		return strings.Contains(name, input)
+func logRowsPrompt(r *git.Repository, opts *PromptOptions, view *logView) error {
+	rows := view.visible()
+	if len(rows) == 0 {
+		// nothing matches the query, fall back to the whole log
+		view.query = ""
+		rows = view.visible()
+	}
+	searcher := func(input string, index int) bool {
+		score, _ := parseLogQuery(input).score(rows[index].Commit)
+		return score > 0
 	}
 	var prompt promptui.Select
+	stop := false
+	// the result of the export or of the recursed prompt
+	var recursed error
 	kset := make(map[rune]promptui.CustomFunc)
 	kset['q'] = func(in interface{}, chb chan bool, index int) error {
 		chb <- true
@@ -95,7 +159,7 @@ func logPrompt(r *git.Repository, opts *PromptOptions, commits []*git.Commit) er
 	}
 	kset['s'] = func(in interface{}, chb chan bool, index int) error {
 		screenbuf.Clear(os.Stdin)
-		if err := popCommitStat(commits[index].Hash); err != nil {
+		if err := popCommitStat(rows[index].Hash); err != nil {
 			return err
 		}
 		chb <- true
@@ -105,11 +169,11 @@ func logPrompt(r *git.Repository, opts *PromptOptions, commits []*git.Commit) er
 			Size:     opts.Size,
 			HideHelp: opts.HideHelp,
 		}
-		return logPrompt(r, o, commits)
+		return logRowsPrompt(r, o, view)
 	}
 	kset['d'] = func(in interface{}, chb chan bool, index int) error {
 		screenbuf.Clear(os.Stdin)
-		if err := popCommitDiff(commits[index].Hash); err != nil {
+		if err := popCommitDiff(rows[index].Hash); err != nil {
 			return err
 		}
 		chb <- true
@@ -119,23 +183,77 @@ func logPrompt(r *git.Repository, opts *PromptOptions, commits []*git.Commit) er
 			Size:     opts.Size,
 			HideHelp: opts.HideHelp,
 		}
-		return logPrompt(r, o, commits)
+		return logRowsPrompt(r, o, view)
+	}
+	kset[' '] = func(in interface{}, chb chan bool, index int) error {
+		rows[index].Marked = !rows[index].Marked
+		chb <- false
+		prompt.RefreshList(rows, index)
+		return nil
+	}
+	kset['e'] = func(in interface{}, chb chan bool, index int) error {
+		chb <- true
+		stop = true
+		screenbuf.Clear(os.Stdin)
+		recursed = exportPrompt(r, markedCommits(view.rows, rows[index]), opts)
+		return recursed
+	}
+	kset['f'] = func(in interface{}, chb chan bool, index int) error {
+		chb <- true
+		stop = true
+		screenbuf.Clear(os.Stdin)
+		search := promptui.Prompt{
+			Label:   "Search (@author #tag :hash)",
+			Default: view.query,
+		}
+		if query, err := search.Run(); err == nil {
+			view.query = query
+		}
+		if !view.decorated && len(parseLogQuery(view.query).decors) > 0 {
+			commits := make([]*git.Commit, len(view.rows))
+			for i, row := range view.rows {
+				commits[i] = row.Commit
+			}
+			if err := r.Decorate(commits); err != nil {
+				recursed = err
+				return err
+			}
+			view.decorated = true
+		}
+		recursed = logRowsPrompt(r, &PromptOptions{
+			Size:     opts.Size,
+			HideHelp: opts.HideHelp,
+		}, view)
+		return recursed
 	}
 
+	label := "Commits"
+	if len(view.query) > 0 {
+		label = label + " [" + view.query + "]"
+	}
+	if r.ApplyingMailbox() {
+		label = label + " (am in progress)"
+	}
 	prompt = promptui.Select{
-		Label:       "Commits",
-		Items:       commits,
+		Label:       label,
+		Items:       rows,
 		HideHelp:    opts.HideHelp,
 		Size:        opts.Size,
 		Searcher:    searcher,
 		Templates:   logTemplate(),
 		CustomFuncs: kset,
 	}
+	prompt.Templates.Active = "* {{ if .Marked }}{{ \"+\" | yellow }}{{ else }} {{ end }}{{ printf \"%.7s\" .Hash | cyan}} {{ if .Highlighted }}{{ .Highlighted }}{{ else }}{{ .Summary | green}}{{ end }}"
+	prompt.Templates.Inactive = "  {{ if .Marked }}{{ \"+\" | yellow }}{{ else }} {{ end }}{{ printf \"%.7s\" .Hash | cyan}} {{ if .Highlighted }}{{ .Highlighted }}{{ else }}{{ .Summary}}{{ end }}"
+	prompt.Templates.Extra = "select: enter mark: space export: e search: f"
 	// make terminal not line wrap
 	fmt.Printf("\x1b[?7l")
 	// defer restoring line wrap
 	defer fmt.Printf("\x1b[?7h")
 	i, _, err := prompt.RunCursorAt(opts.Cursor, opts.Scroll)
+	if stop {
+		return recursed
+	}
 
 	if err == nil {
 		o := &PromptOptions{
@@ -144,16 +262,56 @@ func logPrompt(r *git.Repository, opts *PromptOptions, commits []*git.Commit) er
 			Size:     opts.Size,
 			HideHelp: opts.HideHelp,
 		}
-		if err := statPrompt(r, commits[i], o); err != nil && err == NoErrRecurse {
+		if err := statPrompt(r, []*git.Commit{rows[i].Commit}, o); err != nil && err == NoErrRecurse {
 			o := &PromptOptions{
 				Cursor:   prompt.CursorPosition(),
 				Scroll:   prompt.ScrollPosition(),
 				Size:     opts.Size,
 				HideHelp: opts.HideHelp,
 			}
-			return logPrompt(r, o, commits)
+			return logRowsPrompt(r, o, view)
+		}
+	}
+	return nil
+}
+
+// markedCommits returns the marked commits oldest first so that they can be
+// applied in order, the current row is used if nothing is marked
+func markedCommits(rows []*logRow, current *logRow) []*git.Commit {
+	commits := make([]*git.Commit, 0)
+	for i := len(rows) - 1; i >= 0; i-- {
+		if rows[i].Marked {
+			commits = append(commits, rows[i].Commit)
 		}
 	}
+	if len(commits) == 0 {
+		commits = append(commits, current.Commit)
+	}
+	return commits
+}
+
+// exportPrompt asks whether to add a cover letter and writes the commits
+// as patches into the current directory
+func exportPrompt(r *git.Repository, commits []*git.Commit, opts *PromptOptions) error {
+	items := []string{"Without a cover letter", "With a cover letter"}
+	prompt := promptui.Select{
+		Label:     "Export " + strconv.Itoa(len(commits)) + " commit(s) as patches",
+		Items:     items,
+		HideHelp:  opts.HideHelp,
+		Size:      opts.Size,
+		Templates: stringsTemplate(),
+	}
+	i, _, err := prompt.Run()
+	if err != nil {
+		return nil
+	}
+	files, err := r.FormatPatch(commits, ".", i == 1)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		fmt.Println(f)
+	}
 	return nil
 }
 
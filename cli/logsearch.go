@@ -0,0 +1,191 @@
+package cli
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/fatih/color"
+	"github.com/isacikgoz/gitin/git"
+)
+
+// logQuery is the parsed search input of the log prompt. Words are matched
+// against every field, "@word" only against the author, "#word" only
+// against the tags and branches and ":word" only against the hash.
+type logQuery struct {
+	terms   []string
+	authors []string
+	decors  []string
+	hashes  []string
+}
+
+func parseLogQuery(input string) *logQuery {
+	q := &logQuery{}
+	for _, word := range strings.Fields(strings.ToLower(input)) {
+		switch {
+		case len(word) > 1 && word[0] == '@':
+			q.authors = append(q.authors, word[1:])
+		case len(word) > 1 && word[0] == '#':
+			q.decors = append(q.decors, word[1:])
+		case len(word) > 1 && word[0] == ':':
+			q.hashes = append(q.hashes, word[1:])
+		default:
+			q.terms = append(q.terms, word)
+		}
+	}
+	return q
+}
+
+func (q *logQuery) empty() bool {
+	return len(q.terms)+len(q.authors)+len(q.decors)+len(q.hashes) == 0
+}
+
+// score rates how well the commit matches, every word of the query should
+// match for a positive score. The positions of the summary that matched
+// are returned for highlighting.
+func (q *logQuery) score(c *git.Commit) (int, []int) {
+	total := 0
+	for _, h := range q.hashes {
+		if !strings.HasPrefix(c.Hash, h) {
+			return 0, nil
+		}
+		total += 100
+	}
+	author := c.Author.Name + " " + c.Author.Email
+	for _, a := range q.authors {
+		s, _ := fuzzyScore(a, author)
+		if s == 0 {
+			return 0, nil
+		}
+		total += s
+	}
+	decor := decorations(c)
+	for _, d := range q.decors {
+		s, _ := fuzzyScore(d, decor)
+		if s == 0 {
+			return 0, nil
+		}
+		total += s
+	}
+	highlights := make([]int, 0)
+	for _, t := range q.terms {
+		best := 0
+		if strings.HasPrefix(c.Hash, t) {
+			best = 100
+		}
+		// the summary is preferred to the rest of the message
+		s, positions := fuzzyScore(t, c.Summary)
+		if s = s * 2; s > best {
+			best = s
+			highlights = append(highlights, positions...)
+		}
+		for _, field := range []string{author, decor, c.Message} {
+			if s, _ := fuzzyScore(t, field); s > best {
+				best = s
+			}
+		}
+		if best == 0 {
+			return 0, nil
+		}
+		total += best
+	}
+	return total, highlights
+}
+
+// decorations returns the names of the tag and the branches of the commit
+func decorations(c *git.Commit) string {
+	names := make([]string, 0)
+	if c.Tag != nil {
+		names = append(names, c.Tag.Name)
+	}
+	for _, b := range c.Heads {
+		names = append(names, b.Name)
+	}
+	return strings.Join(names, " ")
+}
+
+// fuzzyScore matches the pattern as a subsequence of the target, case is
+// ignored. Consecutive runes and runes at the start of words score higher,
+// the score is 0 if the pattern does not match. The rune positions of the
+// target that matched are returned.
+func fuzzyScore(pattern, target string) (int, []int) {
+	if len(pattern) == 0 {
+		return 0, nil
+	}
+	runes := []rune(strings.ToLower(target))
+	positions := make([]int, 0)
+	score := 0
+	prev := -2
+	i := 0
+	for _, p := range pattern {
+		for i < len(runes) && runes[i] != p {
+			i++
+		}
+		if i == len(runes) {
+			return 0, nil
+		}
+		score++
+		if i == prev+1 {
+			score += 5
+		}
+		if i == 0 || !unicode.IsLetter(runes[i-1]) && !unicode.IsDigit(runes[i-1]) {
+			score += 3
+		}
+		positions = append(positions, i)
+		prev = i
+		i++
+	}
+	if positions[0] == 0 {
+		score += 8
+	}
+	return score, positions
+}
+
+// rankLogRows returns the rows that match the query, the best match comes
+// first and equal matches keep their order in the log. The matched runes of
+// the summaries are highlighted.
+func rankLogRows(rows []*logRow, input string) []*logRow {
+	q := parseLogQuery(input)
+	for _, row := range rows {
+		row.Highlighted = ""
+	}
+	if q.empty() {
+		return rows
+	}
+	scores := make(map[*logRow]int)
+	ranked := make([]*logRow, 0)
+	for _, row := range rows {
+		s, positions := q.score(row.Commit)
+		if s == 0 {
+			continue
+		}
+		scores[row] = s
+		row.Highlighted = highlight(row.Summary, positions)
+		ranked = append(ranked, row)
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return scores[ranked[i]] > scores[ranked[j]]
+	})
+	return ranked
+}
+
+// highlight underlines the runes at the positions
+func highlight(s string, positions []int) string {
+	if len(positions) == 0 {
+		return ""
+	}
+	marked := make(map[int]bool)
+	for _, p := range positions {
+		marked[p] = true
+	}
+	bold := color.New(color.FgYellow, color.Bold, color.Underline)
+	var b strings.Builder
+	for i, r := range []rune(s) {
+		if marked[i] {
+			b.WriteString(bold.Sprint(string(r)))
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
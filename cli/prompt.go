@@ -5,7 +5,13 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 
+	"github.com/isacikgoz/gitin/git"
+	"github.com/isacikgoz/promptui"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -20,8 +26,16 @@ type PromptOptions struct {
 var (
 	// NoErrRecurse is just a indactor to the caller to pop prompt back
 	NoErrRecurse error = errors.New("catch")
+
+	// promptMu guards the repository while it is reloaded by a watcher and
+	// modified by the key bindings of a prompt
+	promptMu sync.Mutex
 )
 
+// watchDebounce is how long the repository should be quiet before a prompt
+// is reloaded
+const watchDebounce = 300 * time.Millisecond
+
 func popMore(in string) error {
 	os.Setenv("LESS", "-RC")
 	cmd := exec.Command("less")
@@ -46,3 +60,54 @@ func popMore(in string) error {
 	}
 	return NoErrRecurse
 }
+
+// fuzzyMatch is true if every rune of the input appears in the target in
+// the same order, case is ignored
+func fuzzyMatch(input, target string) bool {
+	input = strings.ToLower(strings.Replace(input, " ", "", -1))
+	target = strings.ToLower(target)
+	for _, r := range input {
+		i := strings.IndexRune(target, r)
+		if i < 0 {
+			return false
+		}
+		target = target[i+utf8.RuneLen(r):]
+	}
+	return true
+}
+
+// watchPrompt calls reload whenever the repository changes while a prompt
+// is open, the returned func stops watching. Once it returns, a reload is
+// neither running nor started again.
+func watchPrompt(r *git.Repository, reload func()) func() {
+	stopped := false
+	w, err := r.Watch(watchDebounce, func() {
+		promptMu.Lock()
+		defer promptMu.Unlock()
+		if !stopped {
+			reload()
+		}
+	})
+	if err != nil {
+		log.Warn(err.Error())
+		return func() {}
+	}
+	return func() {
+		w.Close()
+		promptMu.Lock()
+		stopped = true
+		promptMu.Unlock()
+	}
+}
+
+// stringsTemplate is the template of a plain list to choose from
+func stringsTemplate() *promptui.SelectTemplates {
+	templates := &promptui.SelectTemplates{
+		Label:    "{{ . |yellow}}:",
+		Active:   "* {{ . | green }}",
+		Inactive: "  {{ . }}",
+		Selected: "{{ . }}",
+		Extra:    "select: enter",
+	}
+	return templates
+}
@@ -4,7 +4,10 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"strconv"
+	"strings"
 
+	"github.com/fatih/color"
 	"github.com/isacikgoz/gitin/git"
 	"github.com/isacikgoz/promptui"
 	"github.com/isacikgoz/promptui/screenbuf"
@@ -12,13 +15,37 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-func statPrompt(r *git.Repository, c *git.Commit, opts *PromptOptions) error {
+// statPrompt lists the changed files of the last commit of the trail. The
+// trail is the path walked through parents and children, going back pops
+// the last commit and quitting returns to the log.
+func statPrompt(r *git.Repository, trail []*git.Commit, opts *PromptOptions) error {
+	c := trail[len(trail)-1]
 	var back bool
 	diff, err := r.DiffFromHash(c.Hash)
 	if err != nil {
 		return err
 	}
+	children := r.ChildrenOf(c)
 
+	var prompt promptui.Select
+	stop := false
+	// the result of the recursed prompt, it tells the log prompt to come back
+	var recursed error
+	// walk recurses into the trail, the cursor is kept if the commit is the same
+	walk := func(next []*git.Commit) error {
+		o := &PromptOptions{
+			Cursor:   0,
+			Scroll:   0,
+			Size:     opts.Size,
+			HideHelp: opts.HideHelp,
+		}
+		if next[len(next)-1] == c {
+			o.Cursor = prompt.CursorPosition()
+			o.Scroll = prompt.ScrollPosition()
+		}
+		recursed = statPrompt(r, next, o)
+		return recursed
+	}
 	kset := make(map[rune]promptui.CustomFunc)
 	kset['q'] = func(in interface{}, chb chan bool, index int) error {
 		screenbuf.Clear(os.Stdin)
@@ -26,16 +53,67 @@ func statPrompt(r *git.Repository, c *git.Commit, opts *PromptOptions) error {
 		back = true
 		return nil
 	}
+	kset['b'] = func(in interface{}, chb chan bool, index int) error {
+		screenbuf.Clear(os.Stdin)
+		chb <- true
+		if len(trail) == 1 {
+			back = true
+			return nil
+		}
+		stop = true
+		return walk(trail[:len(trail)-1])
+	}
+	kset['i'] = func(in interface{}, chb chan bool, index int) error {
+		screenbuf.Clear(os.Stdin)
+		if err := popLess(r, c, commitDetail(c)); err != nil {
+			return err
+		}
+		chb <- true
+		stop = true
+		return walk(trail)
+	}
+	kset['f'] = func(in interface{}, chb chan bool, index int) error {
+		chb <- true
+		stop = true
+		screenbuf.Clear(os.Stdin)
+		if err := filePrompt(r, c, diff.Deltas()[index], opts); err != nil {
+			return err
+		}
+		return walk(trail)
+	}
+	kset['p'] = func(in interface{}, chb chan bool, index int) error {
+		if len(c.Parents) == 0 {
+			return nil
+		}
+		parents, err := r.ParentsOf(c)
+		if err != nil {
+			return err
+		}
+		chb <- true
+		stop = true
+		return walk(pickCommit(trail, "Parents", parents, opts))
+	}
+	kset['c'] = func(in interface{}, chb chan bool, index int) error {
+		if len(children) == 0 {
+			return nil
+		}
+		chb <- true
+		stop = true
+		return walk(pickCommit(trail, "Children", children, opts))
+	}
 
-	prompt := promptui.Select{
-		Label:       c,
+	prompt = promptui.Select{
+		Label:       breadcrumb(trail),
 		Items:       diff.Deltas(),
 		HideHelp:    opts.HideHelp,
 		Size:        opts.Size,
-		Templates:   statTemplate(c),
+		Templates:   statTemplate(c, children),
 		CustomFuncs: kset,
 	}
 	i, _, err := prompt.RunCursorAt(opts.Cursor, opts.Scroll)
+	if stop {
+		return recursed
+	}
 	if back {
 		return NoErrRecurse
 	}
@@ -47,12 +125,47 @@ func statPrompt(r *git.Repository, c *git.Commit, opts *PromptOptions) error {
 			HideHelp: opts.HideHelp,
 		}
 		if err = popLess(r, c, diff.Deltas()[i].PatchString()); err == nil {
-			return statPrompt(r, c, o)
+			return statPrompt(r, trail, o)
 		}
 	}
 	return nil
 }
 
+// pickCommit appends the commit to the trail, the user picks one if there
+// are more than one e.g. the parents of a merge commit. The trail is
+// returned as is if nothing is picked.
+func pickCommit(trail []*git.Commit, label string, commits []*git.Commit, opts *PromptOptions) []*git.Commit {
+	next := commits[0]
+	if len(commits) > 1 {
+		screenbuf.Clear(os.Stdin)
+		prompt := promptui.Select{
+			Label:     label,
+			Items:     commits,
+			HideHelp:  opts.HideHelp,
+			Size:      opts.Size,
+			Templates: logTemplate(),
+		}
+		i, _, err := prompt.Run()
+		if err != nil {
+			return trail
+		}
+		next = commits[i]
+	}
+	walked := make([]*git.Commit, len(trail), len(trail)+1)
+	copy(walked, trail)
+	return append(walked, next)
+}
+
+// breadcrumb shows the walked commits and the summary of the last one
+func breadcrumb(trail []*git.Commit) string {
+	crumbs := make([]string, 0)
+	for _, c := range trail[:len(trail)-1] {
+		crumbs = append(crumbs, c.Hash[:7])
+	}
+	crumbs = append(crumbs, trail[len(trail)-1].Summary)
+	return strings.Join(crumbs, " › ")
+}
+
 func popLess(r *git.Repository, c *git.Commit, in string) error {
 	os.Setenv("LESS", "-RC")
 	cmd := exec.Command("less")
@@ -78,17 +191,69 @@ func popLess(r *git.Repository, c *git.Commit, in string) error {
 	return nil
 }
 
-func statTemplate(c *git.Commit) *promptui.SelectTemplates {
+// commitDetail renders the whole commit similar to "git show --format=fuller
+// --no-patch" so that long messages can be read in the pager
+func commitDetail(c *git.Commit) string {
+	yellow := color.New(color.FgYellow)
+	faint := color.New(color.Faint)
+	str := yellow.Sprint("commit "+c.Hash) + "\n"
+	if len(c.Parents) > 0 {
+		str = str + faint.Sprint("Parents:    ") + strings.Join(c.Parents, " ") + "\n"
+	}
+	str = str + faint.Sprint("Author:     ") + c.Author.String() + "\n"
+	str = str + faint.Sprint("AuthorDate: ") + c.Date() + "\n"
+	if c.Committer != nil {
+		str = str + faint.Sprint("Commit:     ") + c.Committer.String() + "\n"
+		str = str + faint.Sprint("CommitDate: ") + c.CommitDate() + "\n"
+	}
+	str = str + "\n    " + c.Summary + "\n"
+	if len(c.Body) > 0 {
+		str = str + "\n"
+		for _, line := range strings.Split(c.Body, "\n") {
+			str = str + "    " + line + "\n"
+		}
+	}
+	if len(c.Trailers) > 0 {
+		str = str + "\n"
+		for _, t := range c.Trailers {
+			str = str + "    " + faint.Sprint(t.Key+":") + " " + t.Value + "\n"
+		}
+	}
+	return str
+}
+
+func statTemplate(c *git.Commit, children []*git.Commit) *promptui.SelectTemplates {
+	details := "\n" +
+		"---------------- Commit Detail -----------------" + "\n" +
+		"{{ \"Hash:\"      | faint }}      " + "{{ \"" + c.Hash + "\" | yellow }}" + "\n"
+	if len(c.Parents) > 0 {
+		details = details + "{{ \"Parents:\"   | faint }}   " + c.ShortParents() + "\n"
+	}
+	details = details +
+		"{{ \"Author:\"    | faint }}    " + c.Author.String() + "\n" +
+		"{{ \"Date:\"      | faint }}      " + c.Date() + " (" + "{{ \"" + c.Since() + "\" | blue }}" + ")"
+	if len(children) > 0 {
+		short := make([]string, 0)
+		for _, child := range children {
+			short = append(short, child.Hash[:7])
+		}
+		details = details + "\n" +
+			"{{ \"Children:\"  | faint }}  " + strings.Join(short, " ")
+	}
+	if c.Committer != nil && c.Committer.String() != c.Author.String() {
+		details = details + "\n" +
+			"{{ \"Committer:\" | faint }} " + c.Committer.String()
+	}
+	if len(c.Trailers) > 0 {
+		details = details + "\n" +
+			"{{ \"Trailers:\"  | faint }}  " + strconv.Itoa(len(c.Trailers)) + " (press i to read the message)"
+	}
 	templates := &promptui.SelectTemplates{
-		Label:    "{{ .Summary | yellow }}",
+		Label:    "{{ . | yellow }}",
 		Active:   "* {{ .String | green}} ",
 		Inactive: "  {{ .String }}",
-		Extra:    "select: enter",
-		Details: "\n" +
-			"---------------- Commit Detail -----------------" + "\n" +
-			"{{ \"Hash:\"   | faint }}   " + "{{ \"" + c.Hash + "\" | yellow }}" + "\n" +
-			"{{ \"Author:\" | faint }} " + c.Author.String() + "\n" +
-			"{{ \"Date:\"   | faint }}   " + c.Date() + " (" + "{{ \"" + c.Since() + "\" | blue }}" + ")",
+		Extra:    "select: enter detail: i file: f parent: p child: c back: b",
+		Details:  details,
 	}
 	return templates
 }
@@ -1,9 +1,11 @@
 package cli
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"strconv"
+	"sync"
 
 	"github.com/fatih/color"
 	"github.com/isacikgoz/gitin/git"
@@ -11,24 +13,37 @@ import (
 )
 
 type StatusOptions struct {
+	Tree      bool
+	Only      string
+	Type      string
+	Ignored   bool
 	PromptOps *PromptOptions
 }
 
 func StatusBuilder(r *git.Repository, opts *StatusOptions) error {
+	if r.IsBare() {
+		return git.ErrBareRepository
+	}
 	if err := r.InitializeBranches(); err != nil {
 		return err
 	}
-	return statusPrompt(r, opts.PromptOps)
+	if opts.Ignored {
+		if err := r.ShowIgnored(true); err != nil {
+			return err
+		}
+	}
+	return statusPrompt(r, opts.PromptOps, newStatusView(opts))
 }
 
-func statusPrompt(r *git.Repository, opts *PromptOptions) error {
+func statusPrompt(r *git.Repository, opts *PromptOptions, view *statusView) error {
 	stop := false
 	if len(r.Status.Entries) <= 0 {
-
-		yellow := color.New(color.FgYellow)
-		fmt.Println("On branch " + yellow.Sprint(r.Branch.Name))
-		fmt.Println(getAheadBehind(r.Branch) + "\n")
-		fmt.Println("Nothing to commit, working tree clean")
+		fmt.Println(headStatus(r) + "\n")
+		if r.Head.State == git.HeadUnborn {
+			fmt.Println("Nothing to commit, create or copy files to track")
+		} else {
+			fmt.Println("Nothing to commit, working tree clean")
+		}
 		return nil
 	}
 	// make terminal not line wrap
@@ -43,33 +58,128 @@ func statusPrompt(r *git.Repository, opts *PromptOptions) error {
 		defer os.Exit(0)
 		return nil
 	}
+	rows := statusRows(r.Status.Entries, view)
+	if len(rows) == 0 {
+		// nothing passes the filters, fall back to the whole list
+		view.indexFilter, view.typeFilter = 0, 0
+		rows = statusRows(r.Status.Entries, view)
+	}
+	// rowsMu guards the rows while the watcher replaces them, a replaced
+	// list is never modified so it is safe to read without promptMu, which
+	// the searcher can't take
+	var rowsMu sync.Mutex
+	// refresh is called with promptMu held
+	refresh := func(index int, err error) {
+		filtered := statusRows(r.Status.Entries, view)
+		if len(filtered) == 0 {
+			err = errors.New("no entries match the filter")
+			view.indexFilter, view.typeFilter = 0, 0
+			filtered = statusRows(r.Status.Entries, view)
+		}
+		rowsMu.Lock()
+		rows = filtered
+		rowsMu.Unlock()
+		prompt.Label = statusLabel(view, err)
+		prompt.RefreshList(filtered, clampIndex(index, len(filtered)))
+	}
+	// rowAt returns the row at the index, it is nil if a reload emptied
+	// the list
+	rowAt := func(index int) *statusRow {
+		rowsMu.Lock()
+		defer rowsMu.Unlock()
+		if index < 0 || index >= len(rows) {
+			return nil
+		}
+		return rows[index]
+	}
+	// indexed counts the staged entries while no reload is running
+	indexed := func() int {
+		promptMu.Lock()
+		defer promptMu.Unlock()
+		return r.NumberOfIndexedEntries()
+	}
+	// stopWatch is set once the prompt is ready to be refreshed
+	stopWatch := func() {}
+	searcher := func(input string, index int) bool {
+		row := rowAt(index)
+		if row == nil || row.Entry == nil {
+			return false
+		}
+		return fuzzyMatch(input, row.Entry.Path())
+	}
 	kset[' '] = func(in interface{}, chb chan bool, index int) error {
-		e := r.Status.Entries[index]
-		if e.Indexed() {
-			r.ResetEntry(e)
-		} else {
-			r.AddEntry(e)
+		promptMu.Lock()
+		defer promptMu.Unlock()
+		row := rowAt(index)
+		if row == nil {
+			return nil
 		}
+		err := toggleRow(r, row, view)
 		chb <- false
-		prompt.RefreshList(r.Status.Entries, index)
+		refresh(index, err)
 		return nil
 	}
 	kset['a'] = func(in interface{}, chb chan bool, index int) error {
-		r.AddAll()
+		promptMu.Lock()
+		defer promptMu.Unlock()
+		err := r.AddAll()
 		chb <- false
-		prompt.RefreshList(r.Status.Entries, index)
+		refresh(index, err)
 		return nil
 	}
 	kset['r'] = func(in interface{}, chb chan bool, index int) error {
-		r.ResetAll()
+		promptMu.Lock()
+		defer promptMu.Unlock()
+		err := r.ResetAll()
+		chb <- false
+		refresh(index, err)
+		return nil
+	}
+	kset['u'] = func(in interface{}, chb chan bool, index int) error {
+		promptMu.Lock()
+		defer promptMu.Unlock()
+		_, err := r.Undo()
+		chb <- false
+		refresh(index, err)
+		return nil
+	}
+	kset['U'] = func(in interface{}, chb chan bool, index int) error {
+		promptMu.Lock()
+		defer promptMu.Unlock()
+		_, err := r.Redo()
+		chb <- false
+		refresh(index, err)
+		return nil
+	}
+	kset['t'] = func(in interface{}, chb chan bool, index int) error {
+		promptMu.Lock()
+		defer promptMu.Unlock()
+		view.tree = !view.tree
+		chb <- false
+		refresh(0, nil)
+		return nil
+	}
+	kset['f'] = func(in interface{}, chb chan bool, index int) error {
+		promptMu.Lock()
+		defer promptMu.Unlock()
+		view.cycleIndexFilter()
+		chb <- false
+		refresh(0, nil)
+		return nil
+	}
+	kset['F'] = func(in interface{}, chb chan bool, index int) error {
+		promptMu.Lock()
+		defer promptMu.Unlock()
+		view.cycleTypeFilter()
 		chb <- false
-		prompt.RefreshList(r.Status.Entries, index)
+		refresh(0, nil)
 		return nil
 	}
 	kset['c'] = func(in interface{}, chb chan bool, index int) error {
-		if r.NumberOfIndexedEntries() <= 0 {
+		if indexed() <= 0 {
 			return nil
 		}
+		stopWatch()
 		chb <- true
 		opt := &CommitOptions{
 			PromptOps: opts,
@@ -81,12 +191,47 @@ func statusPrompt(r *git.Repository, opts *PromptOptions) error {
 		} else if err != NoErrRecurse {
 			os.Exit(0)
 		}
-		return statusPrompt(r, opts)
+		return statusPrompt(r, opts, view)
+	}
+	kset['i'] = func(in interface{}, chb chan bool, index int) error {
+		row := rowAt(index)
+		if row == nil || row.Entry == nil || row.Entry.Index() != git.IndexTypeUntracked {
+			return nil
+		}
+		stopWatch()
+		chb <- true
+		stop = true
+		if err := ignorePrompt(r, row.Entry, opts); err != nil && err != promptui.ErrInterrupt {
+			view.err = err
+		}
+		return statusPrompt(r, opts, view)
+	}
+	kset['I'] = func(in interface{}, chb chan bool, index int) error {
+		promptMu.Lock()
+		defer promptMu.Unlock()
+		err := r.ShowIgnored(!r.ShowingIgnored())
+		chb <- false
+		refresh(index, err)
+		return nil
+	}
+	kset['e'] = func(in interface{}, chb chan bool, index int) error {
+		row := rowAt(index)
+		if row == nil || row.Entry == nil || row.Entry.Index() != git.IndexTypeIgnored {
+			return nil
+		}
+		stopWatch()
+		chb <- true
+		stop = true
+		if err := explainIgnore(r, row.Entry); err != nil && err != NoErrRecurse {
+			view.err = err
+		}
+		return statusPrompt(r, opts, view)
 	}
 	kset['m'] = func(in interface{}, chb chan bool, index int) error {
-		if r.NumberOfIndexedEntries() <= 0 {
+		if indexed() <= 0 {
 			return nil
 		}
+		stopWatch()
 		chb <- true
 		err := commitAmend(r)
 		if err != nil && err == NoErrRecurse {
@@ -94,18 +239,27 @@ func statusPrompt(r *git.Repository, opts *PromptOptions) error {
 		} else if err != NoErrRecurse {
 			os.Exit(0)
 		}
-		return statusPrompt(r, opts)
+		return statusPrompt(r, opts, view)
 	}
 
 	prompt = promptui.Select{
-		Label:       "Files",
-		Items:       r.Status.Entries,
+		Label:       statusLabel(view, view.err),
+		Items:       rows,
 		HideHelp:    opts.HideHelp,
 		Size:        opts.Size,
+		Searcher:    searcher,
 		Templates:   statusTemplate(r),
 		CustomFuncs: kset,
 	}
+	view.err = nil
+	// the list is reloaded when the files are changed outside of gitin
+	stopWatch = watchPrompt(r, func() {
+		err := r.InitializeStatus()
+		refresh(prompt.CursorPosition(), err)
+	})
+	defer func() { stopWatch() }()
 	i, _, err := prompt.RunCursorAt(opts.Cursor, opts.Scroll)
+	stopWatch()
 
 	if stop {
 		return nil
@@ -118,13 +272,92 @@ func statusPrompt(r *git.Repository, opts *PromptOptions) error {
 			Size:     opts.Size,
 			HideHelp: opts.HideHelp,
 		}
-		if err := popMore(r.Status.Entries[i].Patch()); err == NoErrRecurse {
-			return statusPrompt(r, o)
+		row := rowAt(i)
+		switch {
+		case row == nil:
+			// the list is emptied by a reload, show what is left
+			return statusPrompt(r, o, view)
+		case row.IsHeader():
+			return statusPrompt(r, o, view)
+		case row.IsDir():
+			view.toggleCollapse(row.Section, row.Dir)
+			return statusPrompt(r, o, view)
+		case row.Entry.UntrackedDir():
+			if err := r.ExpandUntracked(row.Entry); err != nil {
+				return err
+			}
+			return statusPrompt(r, o, view)
+		case row.Entry.Index() == git.IndexTypeIgnored:
+			// an ignored file has no diff, show why it is ignored instead
+			if err := explainIgnore(r, row.Entry); err != nil && err != NoErrRecurse {
+				view.err = err
+			}
+			return statusPrompt(r, o, view)
+		}
+		diff, err := r.DiffEntry(row.Entry)
+		if err != nil {
+			return err
+		}
+		if err := popMore(diff.PatchString()); err == NoErrRecurse {
+			return statusPrompt(r, o, view)
 		}
 	}
 	return err
 }
 
+// statusLabel returns the label of the status list, active filters and the
+// error of the last action are shown next to it
+func statusLabel(view *statusView, err error) string {
+	label := "Files"
+	if filters := view.filterString(); len(filters) > 0 {
+		label = label + " [" + filters + "]"
+	}
+	if err != nil {
+		label = label + " (" + err.Error() + ")"
+	}
+	return label
+}
+
+// clampIndex keeps the cursor in the list after it shrinks
+func clampIndex(index, length int) int {
+	if index >= length {
+		index = length - 1
+	}
+	if index < 0 {
+		return 0
+	}
+	return index
+}
+
+// headStatus describes where HEAD is and how the current branch relates to
+// its upstream
+func headStatus(r *git.Repository) string {
+	yellow := color.New(color.FgYellow)
+	switch r.Head.State {
+	case git.HeadDetached:
+		red := color.New(color.FgRed)
+		return red.Sprint("HEAD detached at ") + yellow.Sprint(r.Head.ShortHash()) + amStatus(r)
+	case git.HeadUnborn:
+		return "On branch " + yellow.Sprint(r.Head.Branch) + "\n" + "No commits yet"
+	}
+	str := "On branch " + yellow.Sprint(r.Head.Branch)
+	if r.Branch != nil {
+		str = str + "\n" + getAheadBehind(r.Branch)
+	}
+	return str + amStatus(r)
+}
+
+// amStatus tells that a patch waits to be resolved, it is empty if no "am"
+// session is in progress
+func amStatus(r *git.Repository) string {
+	if !r.ApplyingMailbox() {
+		return ""
+	}
+	red := color.New(color.FgRed)
+	return "\n" + red.Sprint("You are in the middle of an am session.") + "\n" +
+		"(\"gitin am\" to continue, skip or abort the patch)"
+}
+
 func getAheadBehind(b *git.Branch) string {
 	if b.Upstream == nil || b.Ahead == nil || b.Behind == nil {
 		return "Your branch is not tracking a remote branch."
@@ -155,14 +388,13 @@ func getAheadBehind(b *git.Branch) string {
 func statusTemplate(r *git.Repository) *promptui.SelectTemplates {
 	templates := &promptui.SelectTemplates{
 		Label:    "{{ . |yellow}}:",
-		Active:   "* {{- if .Indexed }} {{ printf \"%.1s\" .StatusEntryString | green}}{{- else}} {{ printf \"%.1s\" .StatusEntryString | red}}{{- end}} {{ .String }}",
-		Inactive: "  {{- if .Indexed }}  {{ printf \"%.1s\" .StatusEntryString | green}}{{- else}}  {{ printf \"%.1s\" .StatusEntryString | red}}{{- end}} {{ .String }}",
-		Selected: "{{ .String }}",
-		Extra:    "add/reset: space commit: c amend: m",
+		Active:   statusRowTemplate("* "),
+		Inactive: statusRowTemplate("  "),
+		Selected: "{{ . }}",
+		Extra:    "add/reset: space commit: c amend: m tree: t filter: f/F ignore: i ignored: I explain: e undo/redo: u/U",
 		Details: "\n" +
 			"---------------- Status -----------------" + "\n" +
-			"{{ \"On branch\" }} " + "{{ \"" + r.Branch.Name + "\" | yellow }}" + "\n" +
-			getAheadBehind(r.Branch),
+			headStatus(r),
 	}
 	return templates
 }
@@ -0,0 +1,319 @@
+package cli
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/isacikgoz/gitin/git"
+)
+
+// statusView holds the presentation state of the status list, it is
+// passed along when the prompt is built again
+type statusView struct {
+	tree      bool
+	collapsed map[string]bool
+	// position in indexFilters and typeFilters, zero means no filter
+	indexFilter int
+	typeFilter  int
+	// err is shown in the label when the prompt is built again
+	err error
+}
+
+// indexFilters are the sections that can be shown alone
+var indexFilters = []git.IndexType{
+	git.IndexTypeStaged,
+	git.IndexTypeUnstaged,
+	git.IndexTypeUntracked,
+	git.IndexTypeConflicted,
+	git.IndexTypeIgnored,
+}
+
+// typeFilters are the change types that can be shown alone
+var typeFilters = []git.StatusEntryType{
+	git.StatusEntryTypeAdded,
+	git.StatusEntryTypeDeleted,
+	git.StatusEntryTypeModified,
+	git.StatusEntryTypeRenamed,
+	git.StatusEntryTypeTypeChange,
+	git.StatusEntryTypeUntracked,
+	git.StatusEntryTypeConflicted,
+	git.StatusEntryTypeIgnored,
+}
+
+func newStatusView(opts *StatusOptions) *statusView {
+	v := &statusView{
+		tree:      opts.Tree,
+		collapsed: make(map[string]bool),
+	}
+	for i, index := range indexFilters {
+		if strings.EqualFold(index.String(), opts.Only) {
+			v.indexFilter = i + 1
+		}
+	}
+	for i, t := range typeFilters {
+		if strings.EqualFold(strings.Replace(t.String(), " ", "", -1), opts.Type) {
+			v.typeFilter = i + 1
+		}
+	}
+	return v
+}
+
+// cycleIndexFilter moves to the next section filter, after the last one
+// the filter is cleared
+func (v *statusView) cycleIndexFilter() {
+	v.indexFilter = (v.indexFilter + 1) % (len(indexFilters) + 1)
+}
+
+// cycleTypeFilter moves to the next type filter, after the last one the
+// filter is cleared
+func (v *statusView) cycleTypeFilter() {
+	v.typeFilter = (v.typeFilter + 1) % (len(typeFilters) + 1)
+}
+
+// filter returns the entries that pass the section and type filters
+func (v *statusView) filter(entries []*git.StatusEntry) []*git.StatusEntry {
+	filtered := make([]*git.StatusEntry, 0)
+	for _, e := range entries {
+		if v.indexFilter > 0 && e.Index() != indexFilters[v.indexFilter-1] {
+			continue
+		}
+		if v.typeFilter > 0 && e.Type() != typeFilters[v.typeFilter-1] {
+			continue
+		}
+		filtered = append(filtered, e)
+	}
+	return filtered
+}
+
+// filterString describes the active filters, it is empty if there are none
+func (v *statusView) filterString() string {
+	filters := make([]string, 0)
+	if v.indexFilter > 0 {
+		filters = append(filters, strings.ToLower(indexFilters[v.indexFilter-1].String()))
+	}
+	if v.typeFilter > 0 {
+		filters = append(filters, strings.ToLower(typeFilters[v.typeFilter-1].String()))
+	}
+	return strings.Join(filters, ", ")
+}
+
+// isCollapsed is true if the directory of the section is folded
+func (v *statusView) isCollapsed(section git.IndexType, dir string) bool {
+	return v.collapsed[section.String()+":"+dir]
+}
+
+// toggleCollapse folds or unfolds the directory of the section
+func (v *statusView) toggleCollapse(section git.IndexType, dir string) {
+	key := section.String() + ":" + dir
+	v.collapsed[key] = !v.collapsed[key]
+}
+
+// hidden is true if any of the directories is folded
+func (v *statusView) hidden(section git.IndexType, dirs []string) bool {
+	for _, dir := range dirs {
+		if v.isCollapsed(section, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// statusRow is a single line of the status list, it is either a section
+// header, a directory or a file entry
+type statusRow struct {
+	Section   git.IndexType
+	Entry     *git.StatusEntry
+	Dir       string
+	Name      string
+	Depth     int
+	Count     int
+	Collapsed bool
+}
+
+// IsHeader is true if the row is a section title
+func (s *statusRow) IsHeader() bool {
+	return s.Entry == nil && len(s.Dir) == 0
+}
+
+// IsDir is true if the row is a directory in the tree view
+func (s *statusRow) IsDir() bool {
+	return s.Entry == nil && len(s.Dir) > 0
+}
+
+// Indent returns the padding of the row in the tree
+func (s *statusRow) Indent() string {
+	return strings.Repeat("  ", s.Depth)
+}
+
+func (s *statusRow) String() string {
+	if s.IsHeader() {
+		return s.Section.String()
+	}
+	if s.IsDir() {
+		return s.Dir + "/"
+	}
+	return s.Entry.String()
+}
+
+// statusRows puts the entries that pass the filters under their section
+// headers, entries are expected to be grouped by their index type already
+func statusRows(entries []*git.StatusEntry, view *statusView) []*statusRow {
+	entries = view.filter(entries)
+	sections := make([][]*git.StatusEntry, 0)
+	for i, e := range entries {
+		if i == 0 || entries[i-1].Index() != e.Index() {
+			sections = append(sections, make([]*git.StatusEntry, 0))
+		}
+		sections[len(sections)-1] = append(sections[len(sections)-1], e)
+	}
+	rows := make([]*statusRow, 0)
+	for _, section := range sections {
+		rows = append(rows, &statusRow{Section: section[0].Index()})
+		if view.tree {
+			rows = append(rows, treeRows(section, view)...)
+			continue
+		}
+		for _, e := range section {
+			rows = append(rows, &statusRow{
+				Section: e.Index(),
+				Entry:   e,
+				Name:    e.String(),
+			})
+		}
+	}
+	return rows
+}
+
+// treeRows lists the entries of a section under their directories, the
+// directories carry the number of entries in them
+func treeRows(entries []*git.StatusEntry, view *statusView) []*statusRow {
+	section := entries[0].Index()
+	sorted := make([]*git.StatusEntry, len(entries))
+	copy(sorted, entries)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Path() < sorted[j].Path()
+	})
+
+	counts := make(map[string]int)
+	for _, e := range sorted {
+		for _, dir := range parentDirs(e.Path()) {
+			counts[dir]++
+		}
+	}
+
+	rows := make([]*statusRow, 0)
+	// directories of the previous entry, they are already listed
+	listed := make([]string, 0)
+	for _, e := range sorted {
+		dirs := parentDirs(e.Path())
+		common := 0
+		for common < len(dirs) && common < len(listed) && dirs[common] == listed[common] {
+			common++
+		}
+		listed = dirs
+		for depth := common; depth < len(dirs); depth++ {
+			if view.hidden(section, dirs[:depth]) {
+				break
+			}
+			rows = append(rows, &statusRow{
+				Section:   section,
+				Dir:       dirs[depth],
+				Name:      path.Base(dirs[depth]) + "/",
+				Depth:     depth,
+				Count:     counts[dirs[depth]],
+				Collapsed: view.isCollapsed(section, dirs[depth]),
+			})
+		}
+		if view.hidden(section, dirs) {
+			continue
+		}
+		name := path.Base(e.Path())
+		if e.Renamed() || e.UntrackedDir() {
+			name = e.String()
+			if len(dirs) > 0 {
+				name = strings.TrimPrefix(name, dirs[len(dirs)-1]+"/")
+			}
+		}
+		rows = append(rows, &statusRow{
+			Section: section,
+			Entry:   e,
+			Name:    name,
+			Depth:   len(dirs),
+		})
+	}
+	return rows
+}
+
+// parentDirs returns every directory that the path is in, from the top
+// e.g. a/b/c.txt gives a and a/b
+func parentDirs(p string) []string {
+	dirs := make([]string, 0)
+	dir := path.Dir(strings.TrimSuffix(p, "/"))
+	for dir != "." && dir != "/" {
+		dirs = append([]string{dir}, dirs...)
+		dir = path.Dir(dir)
+	}
+	return dirs
+}
+
+// rowEntries returns the entries that the row stands for; a single entry,
+// every entry in a directory or in a whole section. Only the entries that
+// pass the filters of the view are given, like in the list.
+func rowEntries(r *git.Repository, row *statusRow, view *statusView) []*git.StatusEntry {
+	if row.Entry != nil {
+		return []*git.StatusEntry{row.Entry}
+	}
+	entries := make([]*git.StatusEntry, 0)
+	for _, e := range view.filter(r.Status.Entries) {
+		if e.Index() != row.Section {
+			continue
+		}
+		if row.IsDir() && !strings.HasPrefix(e.Path(), row.Dir+"/") {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// toggleRow adds or resets the entries of the row, the entries of a
+// directory or a section are in the same section so they are either all
+// added or all reset at once
+func toggleRow(r *git.Repository, row *statusRow, view *statusView) error {
+	// ignored files are not staged, the ignore rule should be removed
+	if row.Section == git.IndexTypeIgnored {
+		return nil
+	}
+	entries := rowEntries(r, row, view)
+	if len(entries) == 0 {
+		return nil
+	}
+	if row.Entry != nil {
+		return toggleEntry(r, row.Entry)
+	}
+	name := row.Dir
+	if !row.IsDir() {
+		name = row.Section.String()
+	}
+	if entries[0].Indexed() {
+		return r.ResetEntries(name, entries)
+	}
+	return r.AddEntries(name, entries)
+}
+
+func toggleEntry(r *git.Repository, e *git.StatusEntry) error {
+	if e.Indexed() {
+		return r.ResetEntry(e)
+	}
+	return r.AddEntry(e)
+}
+
+// statusRowTemplate renders a row of the status list after the cursor
+func statusRowTemplate(cursor string) string {
+	return cursor +
+		"{{ if .IsHeader }}{{ .Section | yellow }}" +
+		"{{ else if .IsDir }}  {{ .Indent }}{{ if .Collapsed }}+{{ else }}-{{ end }} {{ .Name | cyan }} {{ printf \"(%d)\" .Count | faint }}" +
+		"{{ else if .Entry.Indexed }}  {{ .Indent }}{{ printf \"%.1s\" .Entry.StatusEntryString | green }} {{ .Name }}" +
+		"{{ else }}  {{ .Indent }}{{ printf \"%.1s\" .Entry.StatusEntryString | red }} {{ .Name }}{{ end }}"
+}
@@ -0,0 +1,210 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+
+	"github.com/isacikgoz/gitin/git"
+	"github.com/isacikgoz/promptui"
+	"github.com/isacikgoz/promptui/screenbuf"
+)
+
+// TreeOptions is the options of the tree command
+type TreeOptions struct {
+	Revision  string
+	PromptOps *PromptOptions
+}
+
+// TreeBuilder browses the tree of the revision
+func TreeBuilder(r *git.Repository, opts *TreeOptions) error {
+	rev := opts.Revision
+	if len(rev) == 0 {
+		rev = "HEAD"
+	}
+	c, err := r.ResolveRevision(rev)
+	if err != nil {
+		return err
+	}
+	return treePrompt(r, c, "", opts.PromptOps, make(treeCache))
+}
+
+// treeCache keeps the listed entries by commit and dir, so that the last
+// commits are searched once per directory and not on every prompt
+type treeCache map[string][]*git.TreeEntry
+
+// entries returns the entries of the dir in the tree of the commit
+func (t treeCache) entries(r *git.Repository, c *git.Commit, dir string) ([]*git.TreeEntry, error) {
+	key := c.Hash + ":" + dir
+	if entries, ok := t[key]; ok {
+		return entries, nil
+	}
+	entries, err := r.TreeEntries(c, dir)
+	if err != nil {
+		return nil, err
+	}
+	t[key] = entries
+	return entries, nil
+}
+
+// treePrompt lists the entries of the dir, enter opens a directory or reads
+// a file and the parent directory is the first row of sub directories
+func treePrompt(r *git.Repository, c *git.Commit, dir string, opts *PromptOptions, cache treeCache) error {
+	entries, err := cache.entries(r, c, dir)
+	if err != nil {
+		return err
+	}
+	if len(dir) > 0 {
+		parent := &git.TreeEntry{
+			Name: "..",
+			Path: path.Dir(dir),
+			Mode: git.FileModeTree,
+		}
+		entries = append([]*git.TreeEntry{parent}, entries...)
+	}
+	// make terminal not line wrap
+	fmt.Printf("\x1b[?7l")
+	// defer restoring line wrap
+	defer fmt.Printf("\x1b[?7h")
+
+	var prompt promptui.Select
+	stop := false
+	// the result of the recursed prompt
+	var recursed error
+	again := func() error {
+		o := &PromptOptions{
+			Cursor:   prompt.CursorPosition(),
+			Scroll:   prompt.ScrollPosition(),
+			Size:     opts.Size,
+			HideHelp: opts.HideHelp,
+		}
+		recursed = treePrompt(r, c, dir, o, cache)
+		return recursed
+	}
+	searcher := func(input string, index int) bool {
+		return fuzzyMatch(input, entries[index].Name)
+	}
+	kset := make(map[rune]promptui.CustomFunc)
+	kset['q'] = func(in interface{}, chb chan bool, index int) error {
+		chb <- true
+		defer os.Exit(0)
+		return nil
+	}
+	kset['b'] = func(in interface{}, chb chan bool, index int) error {
+		e := entries[index]
+		if e.IsDir() || e.Mode == git.FileModeCommit {
+			return nil
+		}
+		screenbuf.Clear(os.Stdin)
+		if err := popBlame(c.Hash, e.Path); err != nil {
+			return err
+		}
+		chb <- true
+		stop = true
+		return again()
+	}
+	kset['h'] = func(in interface{}, chb chan bool, index int) error {
+		e := entries[index]
+		if e.Name == ".." {
+			return nil
+		}
+		commits, err := r.FileHistory(c, e.Path)
+		if err != nil {
+			return err
+		}
+		chb <- true
+		stop = true
+		screenbuf.Clear(os.Stdin)
+		if err := logPrompt(r, opts, commits); err != nil {
+			recursed = err
+			return err
+		}
+		return again()
+	}
+
+	prompt = promptui.Select{
+		Label:       c.Hash[:7] + ":/" + dir,
+		Items:       entries,
+		HideHelp:    opts.HideHelp,
+		Size:        opts.Size,
+		Searcher:    searcher,
+		Templates:   treeTemplate(entries),
+		CustomFuncs: kset,
+	}
+	i, _, err := prompt.RunCursorAt(opts.Cursor, opts.Scroll)
+	if stop {
+		return recursed
+	}
+	if err != nil {
+		return screenbuf.Clear(os.Stdin)
+	}
+	e := entries[i]
+	if e.IsDir() {
+		next := e.Path
+		if next == "." {
+			next = ""
+		}
+		return treePrompt(r, c, next, &PromptOptions{
+			Size:     opts.Size,
+			HideHelp: opts.HideHelp,
+		}, cache)
+	}
+	if v, err := r.FileAt(c, e); err == nil {
+		screenbuf.Clear(os.Stdin)
+		popMore(v.String())
+	}
+	return treePrompt(r, c, dir, &PromptOptions{
+		Cursor:   prompt.CursorPosition(),
+		Scroll:   prompt.ScrollPosition(),
+		Size:     opts.Size,
+		HideHelp: opts.HideHelp,
+	}, cache)
+}
+
+// popBlame shows "git blame" of the file at the commit in the pager
+func popBlame(hash, file string) error {
+	os.Setenv("LESS", "-RC")
+
+	cmd := exec.Command("git", "blame", hash, "--", file)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Stdin = os.Stdin
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	return cmd.Wait()
+}
+
+func treeTemplate(entries []*git.TreeEntry) *promptui.SelectTemplates {
+	// names are padded so that the columns line up
+	width := 0
+	for _, e := range entries {
+		if len(e.Name) > width {
+			width = len(e.Name)
+		}
+	}
+	name := "printf \"%-" + strconv.Itoa(width) + "s\" .Name"
+	columns := "{{ .Mode | faint }} {{ printf \"%7s\" .SizeString | yellow }} "
+	summary := " {{ .LastCommitSummary | faint }}"
+	templates := &promptui.SelectTemplates{
+		Label:    "{{ . |yellow}}:",
+		Active:   "* " + columns + "{{ if .IsDir }}{{ " + name + " | cyan }}{{ else }}{{ " + name + " | green }}{{ end }}" + summary,
+		Inactive: "  " + columns + "{{ if .IsDir }}{{ " + name + " | cyan }}{{ else }}{{ " + name + " }}{{ end }}" + summary,
+		Selected: "{{ .Path }}",
+		Extra:    "open: enter blame: b history: h",
+		Details: "\n" +
+			"---------------- Entry -----------------" + "\n" +
+			"{{ \"Path:\"   | faint }}   {{ .Path }} ({{ .Kind }})" + "\n" +
+			"{{ \"Hash:\"   | faint }}   {{ .Hash | yellow }}" + "\n" +
+			"{{- if .LastCommit }}" + "\n" +
+			"{{ \"Commit:\" | faint }} {{ .LastCommit.Hash | yellow }}" + "\n" +
+			"{{ \"Author:\" | faint }} {{ .LastCommit.Author }}" + "\n" +
+			"{{ \"Date:\"   | faint }}   {{ .LastCommit.Date }} ({{ .LastCommit.Since | blue }})" + "\n" +
+			"         {{ .LastCommit.Summary }}" +
+			"{{- end }}",
+	}
+	return templates
+}
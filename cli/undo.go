@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/fatih/color"
+	"github.com/isacikgoz/gitin/git"
+)
+
+// UndoOptions is the options of the undo command
+type UndoOptions struct {
+	Redo bool
+	List bool
+}
+
+// UndoBuilder reverts or reapplies the last operation made with gitin, or
+// lists the logged operations
+func UndoBuilder(r *git.Repository, opts *UndoOptions) error {
+	yellow := color.New(color.FgYellow)
+	if opts.List {
+		ops, err := r.Operations()
+		if err != nil {
+			return err
+		}
+		for _, op := range ops {
+			mark := " "
+			if op.Undone {
+				mark = "u"
+			}
+			fmt.Println(mark + " " + yellow.Sprint(op.Time.Format("2006-01-02 15:04:05")) + " " + op.Name)
+		}
+		return nil
+	}
+	if opts.Redo {
+		op, err := r.Redo()
+		if err != nil {
+			return err
+		}
+		fmt.Println("Redone: " + yellow.Sprint(op.Name))
+		return nil
+	}
+	op, err := r.Undo()
+	if err != nil {
+		return err
+	}
+	fmt.Println("Undone: " + yellow.Sprint(op.Name))
+	return nil
+}
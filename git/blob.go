@@ -0,0 +1,125 @@
+package git
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	lib "gopkg.in/libgit2/git2go.v27"
+)
+
+// FileVersion is the content of a file as it is recorded in a commit
+type FileVersion struct {
+	Path string
+	// Commit is the hash of the commit that the version is read from
+	Commit  string
+	Hash    string
+	Mode    FileMode
+	Content []byte
+}
+
+// NewFileVersion returns the file of the delta as it is in the commit
+func (r *Repository) NewFileVersion(c *Commit, d *DiffDelta) (*FileVersion, error) {
+	return r.fileVersion(c.Hash, d.NewFile)
+}
+
+// OldFileVersion returns the file of the delta as it is in the first parent
+// of the commit
+func (r *Repository) OldFileVersion(c *Commit, d *DiffDelta) (*FileVersion, error) {
+	parent := ""
+	if len(c.Parents) > 0 {
+		parent = c.Parents[0]
+	}
+	return r.fileVersion(parent, d.OldFile)
+}
+
+// fileVersion reads the blob of the diff file
+func (r *Repository) fileVersion(commit string, f *DiffFile) (*FileVersion, error) {
+	if len(commit) == 0 || len(strings.Trim(f.Hash, "0")) == 0 {
+		return nil, errors.New(f.Path + " does not exist in that commit")
+	}
+	if f.Mode == FileModeCommit {
+		return nil, errors.New(f.Path + " is a submodule")
+	}
+	oid, err := lib.NewOid(f.Hash)
+	if err != nil {
+		return nil, err
+	}
+	blob, err := r.repo.LookupBlob(oid)
+	if err != nil {
+		return nil, err
+	}
+	defer blob.Free()
+	return &FileVersion{
+		Path:    f.Path,
+		Commit:  commit,
+		Hash:    f.Hash,
+		Mode:    f.Mode,
+		Content: blob.Contents(),
+	}, nil
+}
+
+// Binary is true if the content has a NUL byte in the first 8000 bytes,
+// which is how git decides it as well
+func (v *FileVersion) Binary() bool {
+	head := v.Content
+	if len(head) > 8000 {
+		head = head[:8000]
+	}
+	return bytes.IndexByte(head, 0) >= 0
+}
+
+// String returns the content, binary content is not printed
+func (v *FileVersion) String() string {
+	if v.Binary() {
+		return "Binary file " + v.Path + " at " + v.Commit[:7]
+	}
+	return string(v.Content)
+}
+
+// Save writes the content to the path with the mode of the version
+func (v *FileVersion) Save(path string) error {
+	if v.Mode == FileModeLink {
+		os.Remove(path)
+		return os.Symlink(string(v.Content), path)
+	}
+	perm := os.FileMode(0644)
+	if v.Mode == FileModeBlobExecutable {
+		perm = 0755
+	}
+	return ioutil.WriteFile(path, v.Content, perm)
+}
+
+// RestoreFile writes the version into the working dir, it is the equivalent
+// of "git checkout <commit> -- <path>" if index is set, and of
+// "git restore --source=<commit> <path>" otherwise. It is not logged in the
+// operation log since the overwritten file can't be brought back.
+func (r *Repository) RestoreFile(v *FileVersion, index bool) error {
+	if r.IsBare() {
+		return ErrBareRepository
+	}
+	path := filepath.Join(r.repo.Workdir(), v.Path)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := v.Save(path); err != nil {
+		return err
+	}
+	if index {
+		idx, err := r.repo.Index()
+		if err != nil {
+			return err
+		}
+		defer idx.Free()
+		if err := idx.AddByPath(v.Path); err != nil {
+			return err
+		}
+		if err := idx.Write(); err != nil {
+			return err
+		}
+	}
+	return r.loadStatus()
+}
@@ -1,8 +1,10 @@
 package git
 
 import (
+	"errors"
 	"strconv"
 	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	lib "gopkg.in/libgit2/git2go.v27"
@@ -10,15 +12,18 @@ import (
 
 // Branch is simply a lightweight movable pointer to one of repositories' commits
 type Branch struct {
-	Name       string
-	FullName   string
-	Hash       string
-	Upstream   *Branch
-	Ahead      []*Commit
-	Behind     []*Commit
-	Clean      bool
-	isRemote   bool
-	lastCommit *Commit
+	Name     string
+	FullName string
+	Hash     string
+	Upstream *Branch
+	Ahead    []*Commit
+	Behind   []*Commit
+	Clean    bool
+	// UpstreamGone is true if the branch tracks a remote branch which does
+	// not exist anymore
+	UpstreamGone bool
+	isRemote     bool
+	lastCommit   *Commit
 }
 
 // loadBranches loads branches with the lib's branch iterator loads both remote and
@@ -32,104 +37,105 @@ func (r *Repository) loadBranches() error {
 	defer branchIter.Free()
 
 	err = branchIter.ForEach(func(branch *lib.Branch, branchType lib.BranchType) error {
-
-		name, err := branch.Name()
+		b, err := r.newBranch(branch)
 		if err != nil {
 			return err
 		}
-		fullname := branch.Reference.Name()
+		bs = append(bs, b)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	r.Branches = bs
+	if err := r.loadHead(); err != nil {
+		return err
+	}
+	// Branch is only set when HEAD points to an existing local branch
+	r.Branch = nil
+	if r.Head.State != HeadOnBranch {
+		return nil
+	}
+	for _, b := range r.Branches {
+		if !b.isRemote && b.Name == r.Head.Branch {
+			r.Branch = b
+		}
+	}
+	return nil
+}
 
-		rawOid := branch.Target()
+// newBranch wraps the lib.Branch with its upstream, the commits ahead of
+// and behind it and its last commit
+func (r *Repository) newBranch(branch *lib.Branch) (*Branch, error) {
+	name, err := branch.Name()
+	if err != nil {
+		return nil, err
+	}
+	fullname := branch.Reference.Name()
 
-		if rawOid == nil {
-			ref, err := branch.Resolve()
-			if err != nil {
-				return err
-			}
+	rawOid := branch.Target()
 
-			rawOid = ref.Target()
+	if rawOid == nil {
+		ref, err := branch.Resolve()
+		if err != nil {
+			return nil, err
 		}
 
-		hash := rawOid.String()
-		isRemote := branch.IsRemote()
-		var upstream *Branch
-		var aheads, behinds []*Commit
-		if !isRemote {
-			us, err := branch.Upstream()
-			if err != nil || us == nil {
-				log.Warn("upstream not found")
-			} else {
-				upstream = &Branch{
-					Name:     strings.Replace(us.Name(), "refs/remotes/", "", 1),
-					FullName: us.Name(),
-					Hash:     us.Target().String(),
-					isRemote: true,
-				}
-				var err1, err2 error
-				aheads, err1 = r.revlist(us.Target(), branch.Reference.Target())
-				behinds, err2 = r.revlist(branch.Reference.Target(), us.Target())
-				if err1 != nil || err2 != nil {
-					a, b, err := r.repo.AheadBehind(branch.Reference.Target(), us.Target())
-					if err == nil {
-						aheads = make([]*Commit, a)
-						behinds = make([]*Commit, b)
-					}
+		rawOid = ref.Target()
+	}
+
+	hash := rawOid.String()
+	isRemote := branch.IsRemote()
+	var upstream *Branch
+	var aheads, behinds []*Commit
+	upstreamGone := false
+	if !isRemote {
+		us, err := branch.Upstream()
+		if err != nil || us == nil {
+			log.Warn("upstream not found")
+			upstreamGone = r.hasUpstreamConfig(name)
+		} else {
+			upstream = &Branch{
+				Name:     strings.Replace(us.Name(), "refs/remotes/", "", 1),
+				FullName: us.Name(),
+				Hash:     us.Target().String(),
+				isRemote: true,
+			}
+			var err1, err2 error
+			aheads, err1 = r.revlist(us.Target(), branch.Reference.Target())
+			behinds, err2 = r.revlist(branch.Reference.Target(), us.Target())
+			if err1 != nil || err2 != nil {
+				a, b, err := r.repo.AheadBehind(branch.Reference.Target(), us.Target())
+				if err == nil {
+					aheads = make([]*Commit, a)
+					behinds = make([]*Commit, b)
 				}
 			}
 		}
-		b := &Branch{
-			Name:     name,
-			FullName: fullname,
-			Hash:     hash,
-			isRemote: isRemote,
-			Upstream: upstream,
-			Ahead:    aheads,
-			Behind:   behinds,
-		}
-		if b.lastCommit == nil {
-			objectid, err := lib.NewOid(b.Hash)
+	}
+	b := &Branch{
+		Name:     name,
+		FullName: fullname,
+		Hash:     hash,
+		isRemote: isRemote,
+		Upstream: upstream,
+		Ahead:    aheads,
+		Behind:   behinds,
+
+		UpstreamGone: upstreamGone,
+	}
+	if b.lastCommit == nil {
+		objectid, err := lib.NewOid(b.Hash)
+		if err != nil {
+		} else {
+			commit, err := r.repo.LookupCommit(objectid)
 			if err != nil {
 			} else {
-				commit, err := r.repo.LookupCommit(objectid)
-				if err != nil {
-				} else {
-					hash := commit.AsObject().Id().String()
-					author := &Contributor{
-						Name:  commit.Author().Name,
-						Email: commit.Author().Email,
-						When:  commit.Author().When,
-					}
-					sum := commit.Summary()
-					msg := commit.Message()
-
-					c := &Commit{
-						commit:  commit,
-						Hash:    hash,
-						Author:  author,
-						Message: msg,
-						Summary: sum,
-					}
-					b.lastCommit = c
-				}
+				b.lastCommit = newCommit(commit)
 			}
 		}
-		bs = append(bs, b)
-		return nil
-	})
-	r.Branches = bs
-	head, err := r.repo.Head()
-	if err != nil {
-		return err
-	}
-	for _, b := range r.Branches {
-		if b.isRemote {
-			continue
-		}
-		if head.Target().String() == b.Hash {
-			r.Branch = b
-		}
 	}
-	return err
+	return b, nil
 }
 
 // Status genrates a string similar to "git status"
@@ -189,3 +195,222 @@ func (b *Branch) LastCommitAuthor() string {
 func (b *Branch) IsRemote() bool {
 	return b.isRemote
 }
+
+// LastCommitTime returns the author date of the targeted commit by this branch
+func (b *Branch) LastCommitTime() time.Time {
+	if b.lastCommit != nil {
+		return b.lastCommit.Author.When
+	}
+	return time.Time{}
+}
+
+// LastCommitSince returns how long ago the targeted commit is created
+func (b *Branch) LastCommitSince() string {
+	if b.lastCommit != nil {
+		return b.lastCommit.Since()
+	}
+	return ""
+}
+
+// AheadBehind returns the commit counts compared to upstream e.g. "↑2 ↓1",
+// it is empty if the branch is not tracking a remote branch
+func (b *Branch) AheadBehind() string {
+	if b.Upstream == nil || b.Ahead == nil || b.Behind == nil {
+		return ""
+	}
+	return "↑" + strconv.Itoa(len(b.Ahead)) + " ↓" + strconv.Itoa(len(b.Behind))
+}
+
+// FindBranch returns the loaded branch with the given name
+func (r *Repository) FindBranch(name string) (*Branch, error) {
+	for _, b := range r.Branches {
+		if b.Name == name {
+			return b, nil
+		}
+	}
+	return nil, errors.New("branch " + name + " not found")
+}
+
+// IsMerged is true if the targeted commit of the branch is reachable from
+// the base branch
+func (r *Repository) IsMerged(b, base *Branch) (bool, error) {
+	if b.Hash == base.Hash {
+		return true, nil
+	}
+	oid, err := lib.NewOid(b.Hash)
+	if err != nil {
+		return false, err
+	}
+	baseOid, err := lib.NewOid(base.Hash)
+	if err != nil {
+		return false, err
+	}
+	return r.repo.DescendantOf(baseOid, oid)
+}
+
+// hasUpstreamConfig is true if an upstream is configured for the branch
+func (r *Repository) hasUpstreamConfig(name string) bool {
+	config, err := r.repo.Config()
+	if err != nil {
+		return false
+	}
+	defer config.Free()
+	merge, err := config.LookupString("branch." + name + ".merge")
+	return err == nil && len(merge) > 0
+}
+
+// ErrCurrentBranch is returned when the checked out branch is deleted
+var ErrCurrentBranch = errors.New("cannot delete the checked out branch")
+
+// ErrProtectedBranch is returned when a protected branch is deleted
+var ErrProtectedBranch = errors.New("cannot delete a protected branch")
+
+// UnmergedError is returned when a branch is deleted without force while
+// it has commits that are not merged into HEAD or its upstream
+type UnmergedError struct {
+	Branch  *Branch
+	Commits []*Commit
+}
+
+func (e *UnmergedError) Error() string {
+	return "branch " + e.Branch.Name + " has " + strconv.Itoa(len(e.Commits)) + " unmerged commit(s)"
+}
+
+// IsProtected is true if the branch is in the protected branches list
+func (r *Repository) IsProtected(b *Branch) bool {
+	for _, name := range r.ProtectedBranches {
+		if b.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// DeleteBranch removes the local branch. Unless it is forced, the branch
+// should be merged into its upstream or into HEAD if it has no upstream,
+// like "git branch -d <branch>" does.
+func (r *Repository) DeleteBranch(b *Branch, force bool) error {
+	if b.IsRemote() {
+		return errors.New("cannot delete a remote branch")
+	}
+	if r.Branch != nil && b.Name == r.Branch.Name {
+		return ErrCurrentBranch
+	}
+	if r.IsProtected(b) {
+		return ErrProtectedBranch
+	}
+	if !force {
+		commits, err := r.unmergedCommits(b)
+		if err != nil {
+			return err
+		}
+		if len(commits) > 0 {
+			return &UnmergedError{
+				Branch:  b,
+				Commits: commits,
+			}
+		}
+	}
+	return r.Record("delete branch "+b.Name, []string{b.FullName}, func() error {
+		branch, err := r.repo.LookupBranch(b.Name, lib.BranchLocal)
+		if err != nil {
+			return err
+		}
+		defer branch.Free()
+		return branch.Delete()
+	})
+}
+
+// unmergedCommits returns the commits of the branch that would be lost if
+// the branch is deleted
+func (r *Repository) unmergedCommits(b *Branch) ([]*Commit, error) {
+	target, err := lib.NewOid(b.Hash)
+	if err != nil {
+		return nil, err
+	}
+	var into *lib.Oid
+	if b.Upstream != nil {
+		into, err = lib.NewOid(b.Upstream.Hash)
+	} else {
+		if r.Head.State == HeadUnborn {
+			return nil, ErrUnbornHead
+		}
+		into, err = lib.NewOid(r.Head.Hash)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if into.Equal(target) {
+		return []*Commit{}, nil
+	}
+	return r.revlist(into, target)
+}
+
+// LocalName returns the name of the branch without the remote part e.g.
+// origin/feature gives feature, local branch names are returned as is
+func (b *Branch) LocalName() string {
+	if !b.isRemote {
+		return b.Name
+	}
+	if i := strings.Index(b.Name, "/"); i >= 0 {
+		return b.Name[i+1:]
+	}
+	return b.Name
+}
+
+// LocalBranchFor returns the local branch that has the same name with the
+// remote branch, it is nil if there is none. The branch is looked up in the
+// repository, the loaded branches may be filtered.
+func (r *Repository) LocalBranchFor(remote *Branch) (*Branch, error) {
+	branch, err := r.repo.LookupBranch(remote.LocalName(), lib.BranchLocal)
+	if err != nil {
+		if lib.IsErrorCode(err, lib.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer branch.Free()
+	return r.newBranch(branch)
+}
+
+// CreateTrackingBranch creates a local branch at the remote branch and sets
+// the remote branch as its upstream, it is the equivalent of
+// "git branch --track <name> <remote>/<name>". If force is set an existing
+// local branch with the same name is moved to the remote branch.
+func (r *Repository) CreateTrackingBranch(remote *Branch, force bool) (*Branch, error) {
+	if !remote.isRemote {
+		return nil, errors.New(remote.Name + " is not a remote branch")
+	}
+	name := remote.LocalName()
+	err := r.Record("track "+remote.Name, []string{"refs/heads/" + name}, func() error {
+		oid, err := lib.NewOid(remote.Hash)
+		if err != nil {
+			return err
+		}
+		commit, err := r.repo.LookupCommit(oid)
+		if err != nil {
+			return err
+		}
+		defer commit.Free()
+		branch, err := r.repo.CreateBranch(name, commit, force)
+		if err != nil {
+			return err
+		}
+		defer branch.Free()
+		return branch.SetUpstream(remote.Name)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := r.loadBranches(); err != nil {
+		return nil, err
+	}
+	local, err := r.LocalBranchFor(remote)
+	if err != nil {
+		return nil, err
+	}
+	if local == nil {
+		return nil, errors.New("branch " + name + " not found after creating it")
+	}
+	return local, nil
+}
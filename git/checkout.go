@@ -0,0 +1,279 @@
+package git
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	lib "gopkg.in/libgit2/git2go.v27"
+)
+
+// CheckoutMode decides what happens to the local changes while switching
+type CheckoutMode uint8
+
+const (
+	// CheckoutCarry keeps the local changes in the working dir, it fails if
+	// they conflict with the target branch
+	CheckoutCarry CheckoutMode = iota
+	// CheckoutStash stashes the local changes before switching and applies
+	// them back after
+	CheckoutStash
+)
+
+// ConflictError is returned when local changes would be overwritten by
+// switching to the branch
+type ConflictError struct {
+	Branch *Branch
+	Paths  []string
+}
+
+func (e *ConflictError) Error() string {
+	return "local changes to " + strconv.Itoa(len(e.Paths)) + " file(s) would be overwritten by checking out " + e.Branch.Name
+}
+
+// CheckoutResult is the summary of a checkout
+type CheckoutResult struct {
+	Branch *Branch
+	// Carried are the changed files that are kept while switching
+	Carried []string
+	// Stashed is true if the changes are stashed before switching
+	Stashed bool
+	// StashErr is set if the stash could not be applied back, the stash is
+	// kept in that case
+	StashErr error
+}
+
+func (c *CheckoutResult) String() string {
+	s := "Switched to branch " + c.Branch.Name
+	if c.Stashed {
+		if c.StashErr != nil {
+			s = s + "\nLocal changes are stashed but could not be applied: " + c.StashErr.Error()
+			s = s + "\n(\"git stash pop\" to apply them after resolving)"
+		} else {
+			s = s + "\nLocal changes are stashed and applied back"
+		}
+	} else if len(c.Carried) > 0 {
+		s = s + "\nLocal changes are carried over:\n  " + strings.Join(c.Carried, "\n  ")
+	}
+	return s
+}
+
+// Checkout switches to the branch, it is the equivalent of "git checkout
+// <branch>" and "git stash && git checkout <branch> && git stash pop" with
+// the stash mode
+func (r *Repository) Checkout(b *Branch, mode CheckoutMode) (*CheckoutResult, error) {
+	if r.IsBare() {
+		return nil, ErrBareRepository
+	}
+	if b.IsRemote() {
+		return nil, errors.New("cannot check out a remote branch, create a tracking branch first")
+	}
+	result := &CheckoutResult{
+		Branch:  b,
+		Carried: r.localChanges(),
+	}
+	// untracked files are stashed as well, they may be in the way
+	if len(result.Carried) == 0 && !r.hasUntracked() {
+		mode = CheckoutCarry
+	}
+	if mode == CheckoutCarry {
+		if err := r.CheckoutConflicts(b); err != nil {
+			return nil, err
+		}
+	}
+	err := r.Record("checkout "+b.Name, []string{"HEAD"}, func() error {
+		if mode == CheckoutStash {
+			sig, err := r.repo.DefaultSignature()
+			if err != nil {
+				return err
+			}
+			if _, err := r.repo.Stashes.Save(sig, "gitin: autostash before checking out "+b.Name, lib.StashIncludeUntracked); err != nil {
+				return err
+			}
+			result.Stashed = true
+			result.Carried = nil
+		}
+		if err := r.switchTo(b); err != nil {
+			if !result.Stashed {
+				return err
+			}
+			// give the local changes back, the checkout is abandoned
+			opts, serr := lib.DefaultStashApplyOptions()
+			if serr == nil {
+				serr = r.repo.Stashes.Pop(0, opts)
+			}
+			if serr != nil {
+				result.StashErr = serr
+				return errors.New(err.Error() + "\nLocal changes are stashed but could not be applied: " + serr.Error() +
+					"\n(\"git stash pop\" to apply them after resolving)")
+			}
+			return err
+		}
+		if result.Stashed {
+			opts, err := lib.DefaultStashApplyOptions()
+			if err != nil {
+				result.StashErr = err
+				return nil
+			}
+			result.StashErr = r.repo.Stashes.Pop(0, opts)
+		}
+		return nil
+	})
+	if err != nil {
+		if result.StashErr != nil {
+			// the checkout is not logged, the stash is left to the user
+			return result, err
+		}
+		return nil, err
+	}
+	if result.StashErr != nil {
+		if err := r.markAutostash(); err != nil {
+			return result, err
+		}
+	}
+	if err := r.loadStatus(); err != nil {
+		return result, err
+	}
+	return result, r.loadBranches()
+}
+
+// switchTo updates the working dir and the index to the branch and points
+// HEAD to it
+func (r *Repository) switchTo(b *Branch) error {
+	tree, err := r.branchTree(b)
+	if err != nil {
+		return err
+	}
+	defer tree.Free()
+	opts := &lib.CheckoutOpts{
+		Strategy: lib.CheckoutSafe,
+	}
+	if err := r.repo.CheckoutTree(tree, opts); err != nil {
+		return err
+	}
+	return r.repo.SetHead(b.FullName)
+}
+
+// branchTree returns the tree of the targeted commit by the branch
+func (r *Repository) branchTree(b *Branch) (*lib.Tree, error) {
+	oid, err := lib.NewOid(b.Hash)
+	if err != nil {
+		return nil, err
+	}
+	commit, err := r.repo.LookupCommit(oid)
+	if err != nil {
+		return nil, err
+	}
+	defer commit.Free()
+	return commit.Tree()
+}
+
+// CheckoutConflicts returns a ConflictError if the local changes would be
+// overwritten by switching to the branch
+func (r *Repository) CheckoutConflicts(b *Branch) error {
+	conflicts, err := r.checkoutConflicts(b)
+	if err != nil {
+		return err
+	}
+	if len(conflicts) > 0 {
+		return &ConflictError{
+			Branch: b,
+			Paths:  conflicts,
+		}
+	}
+	return nil
+}
+
+// localChanges returns the paths that are changed in the index or the
+// working dir, untracked files are not counted
+func (r *Repository) localChanges() []string {
+	paths := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, e := range r.Status.Entries {
+		if e.index == IndexTypeUntracked || e.index == IndexTypeIgnored {
+			continue
+		}
+		for _, p := range e.paths() {
+			if !seen[p] {
+				seen[p] = true
+				paths = append(paths, p)
+			}
+		}
+	}
+	return paths
+}
+
+// hasUntracked is true if there are untracked files in the working dir
+func (r *Repository) hasUntracked() bool {
+	for _, e := range r.Status.Entries {
+		if e.index == IndexTypeUntracked {
+			return true
+		}
+	}
+	return false
+}
+
+// checkoutConflicts returns the locally changed paths that differ between
+// HEAD and the branch, and the untracked files that the branch would
+// overwrite
+func (r *Repository) checkoutConflicts(b *Branch) ([]string, error) {
+	target, err := r.branchTree(b)
+	if err != nil {
+		return nil, err
+	}
+	defer target.Free()
+
+	var current *lib.Tree
+	commit, err := r.headCommit()
+	if err != nil {
+		return nil, err
+	}
+	if commit != nil {
+		defer commit.Free()
+		if current, err = commit.Tree(); err != nil {
+			return nil, err
+		}
+		defer current.Free()
+	}
+	opt, err := lib.DefaultDiffOptions()
+	if err != nil {
+		return nil, err
+	}
+	diff, err := r.repo.DiffTreeToTree(current, target, &opt)
+	if err != nil {
+		return nil, err
+	}
+	defer diff.Free()
+
+	differ := make(map[string]bool)
+	count, err := diff.NumDeltas()
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < count; i++ {
+		delta, err := diff.GetDelta(i)
+		if err != nil {
+			return nil, err
+		}
+		differ[delta.OldFile.Path] = true
+		differ[delta.NewFile.Path] = true
+	}
+
+	conflicts := make([]string, 0)
+	for _, p := range r.localChanges() {
+		if differ[p] {
+			conflicts = append(conflicts, p)
+		}
+	}
+	for _, e := range r.Status.Entries {
+		if e.index != IndexTypeUntracked {
+			continue
+		}
+		for p := range differ {
+			if p == e.Path() || (e.UntrackedDir() && strings.HasPrefix(p, e.Path())) {
+				conflicts = append(conflicts, p)
+			}
+		}
+	}
+	return conflicts, nil
+}
@@ -0,0 +1,74 @@
+package git
+
+import (
+	"strings"
+	"time"
+)
+
+// StaleReason tells why a branch is considered stale, a branch can have
+// more than one reason
+type StaleReason uint8
+
+// The reasons for a branch to be stale
+const (
+	// StaleMerged is for branches fully merged into the base branch
+	StaleMerged StaleReason = 1 << iota
+	// StaleUpstreamGone is for branches whose upstream is deleted
+	StaleUpstreamGone
+	// StaleInactive is for branches that have no recent commits
+	StaleInactive
+)
+
+func (s StaleReason) String() string {
+	reasons := make([]string, 0)
+	if s&StaleMerged != 0 {
+		reasons = append(reasons, "merged")
+	}
+	if s&StaleUpstreamGone != 0 {
+		reasons = append(reasons, "upstream gone")
+	}
+	if s&StaleInactive != 0 {
+		reasons = append(reasons, "inactive")
+	}
+	return strings.Join(reasons, ", ")
+}
+
+// StaleBranch is a local branch that is a candidate for deletion
+type StaleBranch struct {
+	Branch  *Branch
+	Reasons StaleReason
+}
+
+// StaleBranches finds the local branches that are merged into base, that
+// track a deleted upstream or that have no commits for the inactive
+// duration. The current branch, the base and protected branches are
+// never stale. Branches should be initialized before.
+func (r *Repository) StaleBranches(base *Branch, inactive time.Duration) ([]*StaleBranch, error) {
+	stale := make([]*StaleBranch, 0)
+	for _, b := range r.Branches {
+		if b.IsRemote() || b == r.Branch || b == base || r.IsProtected(b) {
+			continue
+		}
+		var reasons StaleReason
+		merged, err := r.IsMerged(b, base)
+		if err != nil {
+			return nil, err
+		}
+		if merged {
+			reasons |= StaleMerged
+		}
+		if b.UpstreamGone {
+			reasons |= StaleUpstreamGone
+		}
+		if inactive > 0 && time.Since(b.LastCommitTime()) > inactive {
+			reasons |= StaleInactive
+		}
+		if reasons != 0 {
+			stale = append(stale, &StaleBranch{
+				Branch:  b,
+				Reasons: reasons,
+			})
+		}
+	}
+	return stale, nil
+}
@@ -14,11 +14,17 @@ import (
 
 // Commit is the wrapper of actual lib.Commit object
 type Commit struct {
-	commit  *lib.Commit
-	Hash    string
-	Author  *Contributor
-	Message string
-	Summary string
+	commit    *lib.Commit
+	Hash      string
+	Author    *Contributor
+	Committer *Contributor
+	Message   string
+	Summary   string
+	// Body is the message without the summary and the trailers
+	Body     string
+	Trailers []*Trailer
+	// Parents are the hashes of the parent commits
+	Parents []string
 	Type    CommitType
 	Tag     *Tag
 	Heads   []*Branch
@@ -51,6 +57,11 @@ type CommitLoadOptions struct {
 	MaxCount  int
 	Tags      bool
 	Since     string
+	// Pickaxe keeps the commits that change the number of occurrences of
+	// the string, PickaxeRegex keeps the ones that add or remove a line
+	// matching the expression
+	Pickaxe      string
+	PickaxeRegex string
 }
 
 func (r *Repository) loadCommits(from, to *lib.Oid, opts *CommitLoadOptions) ([]*Commit, error) {
@@ -69,48 +80,52 @@ func (r *Repository) loadCommits(from, to *lib.Oid, opts *CommitLoadOptions) ([]
 	defer walk.Free()
 	counter := 0
 	limit := datefilter(opts) || signaturefilter(opts)
+	p, err := newPickaxe(opts)
+	if err != nil {
+		return cs, err
+	}
+	// the pickaxe diffs each commit, a failing diff stops the walk
+	var pickaxeErr error
 	err = walk.Iterate(func(commit *lib.Commit) bool {
 		oid := commit.AsObject().Id()
 		if to != nil && to.Equal(oid) {
 			return false
 		}
-
-		hash := oid.String()
-		author := &Contributor{
-			Name:  commit.Author().Name,
-			Email: commit.Author().Email,
-			When:  commit.Author().When,
+		// the limits are cheaper than the diff of the pickaxe, run them first
+		if limit {
+			if ok, _ := limitCommit(commit, opts); !ok {
+				return true
+			}
 		}
-		sum := commit.Summary()
-		msg := commit.Message()
-
-		c := &Commit{
-			commit:  commit,
-			Hash:    hash,
-			Author:  author,
-			Message: msg,
-			Summary: sum,
+		if p != nil {
+			ok, err := r.pickaxeMatch(p, commit)
+			if err != nil {
+				pickaxeErr = err
+				return false
+			}
+			if !ok {
+				return true
+			}
 		}
 
+		c := newCommit(commit)
+
 		if tag := r.findTag(c.Hash); tag != nil {
 			c.Tag = tag
 		}
+		c.Heads = r.headsOf(c.Hash)
 
-		if limit {
-			if ok, _ := limitCommit(commit, opts); ok {
-				counter++
-				cs = append(cs, c)
-			}
-		} else {
-			counter++
-			cs = append(cs, c)
-		}
+		counter++
+		cs = append(cs, c)
 
 		if opts.MaxCount != 0 && counter >= opts.MaxCount {
 			return false
 		}
 		return true
 	})
+	if pickaxeErr != nil {
+		return nil, pickaxeErr
+	}
 	r.Commits = cs
 	return cs, nil
 }
@@ -142,6 +157,10 @@ func (r *Repository) failOverShallow(opts *CommitLoadOptions) ([]*Commit, error)
 	re := regexp.MustCompile(`\r?\n`)
 	counter := 0
 	limit := datefilter(opts) || signaturefilter(opts)
+	p, err := newPickaxe(opts)
+	if err != nil {
+		return nil, err
+	}
 	for _, line := range re.Split(string(out), -1) {
 		if line[:7] == shallow[:7] {
 			break
@@ -159,23 +178,19 @@ func (r *Repository) failOverShallow(opts *CommitLoadOptions) ([]*Commit, error)
 				continue
 			}
 		}
-
-		hash := commit.AsObject().Id().String()
-		author := &Contributor{
-			Name:  commit.Author().Name,
-			Email: commit.Author().Email,
-			When:  commit.Author().When,
-		}
-		sum := commit.Summary()
-		msg := commit.Message()
-
-		c := &Commit{
-			commit:  commit,
-			Hash:    hash,
-			Author:  author,
-			Message: msg,
-			Summary: sum,
+		if p != nil {
+			ok, err := r.pickaxeMatch(p, commit)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
 		}
+
+		c := newCommit(commit)
+		c.Tag = r.findTag(c.Hash)
+		c.Heads = r.headsOf(c.Hash)
 		commits = append(commits, c)
 		counter++
 		if opts.MaxCount != 0 && counter >= opts.MaxCount {
@@ -184,6 +199,62 @@ func (r *Repository) failOverShallow(opts *CommitLoadOptions) ([]*Commit, error)
 	}
 	return commits, nil
 }
+
+// headsOf returns the loaded branches that point to the hash
+func (r *Repository) headsOf(hash string) []*Branch {
+	heads := make([]*Branch, 0)
+	for _, b := range r.Branches {
+		if b.Hash == hash {
+			heads = append(heads, b)
+		}
+	}
+	return heads
+}
+
+// Decorate loads the tags and the branches and sets them on the commits,
+// they are not loaded with the commits unless they are asked for
+func (r *Repository) Decorate(commits []*Commit) error {
+	if err := r.InitializeTags(); err != nil {
+		return err
+	}
+	if err := r.InitializeBranches(); err != nil {
+		return err
+	}
+	for _, c := range commits {
+		c.Tag = r.findTag(c.Hash)
+		c.Heads = r.headsOf(c.Hash)
+	}
+	return nil
+}
+
+// newCommit wraps the lib.Commit
+func newCommit(commit *lib.Commit) *Commit {
+	body, trailers := parseMessage(commit.Message())
+	parents := make([]string, 0)
+	for i := uint(0); i < commit.ParentCount(); i++ {
+		parents = append(parents, commit.ParentId(i).String())
+	}
+	return &Commit{
+		commit:    commit,
+		Hash:      commit.AsObject().Id().String(),
+		Author:    newContributor(commit.Author()),
+		Committer: newContributor(commit.Committer()),
+		Message:   commit.Message(),
+		Summary:   commit.Summary(),
+		Body:      body,
+		Trailers:  trailers,
+		Parents:   parents,
+	}
+}
+
+func newContributor(sig *lib.Signature) *Contributor {
+	return &Contributor{
+		Name:  sig.Name,
+		Email: sig.Email,
+		When:  sig.When,
+	}
+}
+
 func (c *Commit) String() string {
 	return c.Hash
 }
@@ -193,6 +264,27 @@ func (c *Commit) Date() string {
 	return c.Author.When.String()
 }
 
+// CommitDate returns the date that the commit is recorded as string, it
+// differs from the author date for rebased or amended commits
+func (c *Commit) CommitDate() string {
+	if c.Committer == nil {
+		return c.Date()
+	}
+	return c.Committer.When.String()
+}
+
+// ShortParents returns the abbreviated hashes of the parents
+func (c *Commit) ShortParents() string {
+	short := make([]string, 0)
+	for _, p := range c.Parents {
+		if len(p) > 7 {
+			p = p[:7]
+		}
+		short = append(short, p)
+	}
+	return strings.Join(short, " ")
+}
+
 // Since returns xx ago string
 func (c *Commit) Since() string {
 	return timeago.FromTime(c.Author.When)
@@ -233,77 +325,69 @@ func (r *Repository) Diff(c *Commit) (*Diff, error) {
 	}
 	defer diff.Free()
 
-	stats, err := diff.Stats()
-	if err != nil {
-		return nil, err
-	}
+	return newDiff(diff)
+}
 
-	statsText, err := stats.String(lib.DiffStatsFull, 80)
+// DiffFromHash is a wrapper for Actual diff which takes a hash string for input
+func (r *Repository) DiffFromHash(hash string) (*Diff, error) {
+	objectid, err := lib.NewOid(hash)
 	if err != nil {
 		return nil, err
 	}
-	ddeltas := make([]*DiffDelta, 0)
-	patchs := make([]string, 0)
-	deltas, err := diff.NumDeltas()
+	c, err := r.repo.LookupCommit(objectid)
 	if err != nil {
 		return nil, err
 	}
+	return r.Diff(&Commit{commit: c})
+}
 
-	var patch *lib.Patch
-	var patchtext string
-
-	for i := 0; i < deltas; i++ {
-		if patch, err = diff.Patch(i); err != nil {
-			continue
-		}
-		var dd lib.DiffDelta
-		if dd, err = diff.GetDelta(i); err != nil {
-			continue
-		}
-		d := &DiffDelta{
-			Status: int(dd.Status),
-			NewFile: &DiffFile{
-				Path: dd.NewFile.Path,
-				Hash: dd.NewFile.Oid.String(),
-			},
-			OldFile: &DiffFile{
-				Path: dd.OldFile.Path,
-				Hash: dd.OldFile.Oid.String(),
-			},
-		}
-
-		if patchtext, err = patch.String(); err != nil {
-			continue
+// LookupCommit returns the commit of the hash, the commit from the loaded
+// history is returned if there is one so that its decorations are kept
+func (r *Repository) LookupCommit(hash string) (*Commit, error) {
+	for _, c := range r.Commits {
+		if c.Hash == hash {
+			return c, nil
 		}
-		d.Patch = patchtext
-
-		ddeltas = append(ddeltas, d)
-		patchs = append(patchs, patchtext)
-
-		if err := patch.Free(); err != nil {
-			return nil, err
-		}
-	}
-
-	d := &Diff{
-		deltas: ddeltas,
-		stats:  strings.Split(statsText, "\n"),
-		patchs: patchs,
 	}
-	return d, nil
-}
-
-// DiffFromHash is a wrapper for Actual diff which takes a hash string for input
-func (r *Repository) DiffFromHash(hash string) (*Diff, error) {
 	objectid, err := lib.NewOid(hash)
 	if err != nil {
 		return nil, err
 	}
-	c, err := r.repo.LookupCommit(objectid)
+	commit, err := r.repo.LookupCommit(objectid)
 	if err != nil {
 		return nil, err
 	}
-	return r.Diff(&Commit{commit: c})
+	c := newCommit(commit)
+	c.Tag = r.findTag(c.Hash)
+	return c, nil
+}
+
+// ParentsOf returns the parent commits in the order they are recorded
+func (r *Repository) ParentsOf(c *Commit) ([]*Commit, error) {
+	parents := make([]*Commit, 0)
+	for _, hash := range c.Parents {
+		p, err := r.LookupCommit(hash)
+		if err != nil {
+			return nil, err
+		}
+		parents = append(parents, p)
+	}
+	return parents, nil
+}
+
+// ChildrenOf returns the commits that have the commit as a parent. Git
+// does not record children, so only the loaded history is searched.
+func (r *Repository) ChildrenOf(c *Commit) []*Commit {
+	children := make([]*Commit, 0)
+	for _, child := range r.Commits {
+		for _, hash := range child.Parents {
+			if hash == c.Hash {
+				children = append(children, child)
+				break
+			}
+		}
+	}
+	return children
 }
 
 // revlist is the wrapped of "git rev-list oid1..oid2" command
@@ -327,22 +411,7 @@ func (r *Repository) revlist(from, to *lib.Oid) ([]*Commit, error) {
 		if err != nil {
 			continue
 		}
-		hash := commit.AsObject().Id().String()
-		author := &Contributor{
-			Name:  commit.Author().Name,
-			Email: commit.Author().Email,
-			When:  commit.Author().When,
-		}
-		sum := commit.Summary()
-		msg := commit.Message()
-
-		c := &Commit{
-			commit:  commit,
-			Hash:    hash,
-			Author:  author,
-			Message: msg,
-			Summary: sum,
-		}
+		c := newCommit(commit)
 		commits = append(commits, c)
 	}
 	return commits, nil
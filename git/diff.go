@@ -2,9 +2,11 @@ package git
 
 import (
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/fatih/color"
+	lib "gopkg.in/libgit2/git2go.v27"
 )
 
 type Diff struct {
@@ -25,26 +27,269 @@ func (d *Diff) Stats() []string {
 	return d.stats
 }
 
+// newDiff collects the deltas, patches and stats of the lib's diff
+func newDiff(diff *lib.Diff) (*Diff, error) {
+	stats, err := diff.Stats()
+	if err != nil {
+		return nil, err
+	}
+
+	statsText, err := stats.String(lib.DiffStatsFull, 80)
+	if err != nil {
+		return nil, err
+	}
+	ddeltas := make([]*DiffDelta, 0)
+	patchs := make([]string, 0)
+	deltas, err := diff.NumDeltas()
+	if err != nil {
+		return nil, err
+	}
+
+	var patch *lib.Patch
+	var patchtext string
+
+	for i := 0; i < deltas; i++ {
+		if patch, err = diff.Patch(i); err != nil {
+			continue
+		}
+		var dd lib.DiffDelta
+		if dd, err = diff.GetDelta(i); err != nil {
+			continue
+		}
+		d := newDiffDelta(dd)
+
+		if patchtext, err = patch.String(); err != nil {
+			continue
+		}
+		d.Patch = patchtext
+
+		ddeltas = append(ddeltas, d)
+		patchs = append(patchs, patchtext)
+
+		if err := patch.Free(); err != nil {
+			return nil, err
+		}
+	}
+
+	d := &Diff{
+		deltas: ddeltas,
+		stats:  strings.Split(statsText, "\n"),
+		patchs: patchs,
+	}
+	return d, nil
+}
+
+// DeltaStatus is the type of change a file has undergone in a diff
+type DeltaStatus int
+
+// The set of supported DeltaStatus values, they are in the same order with
+// the lib's delta types
+const (
+	DeltaUnmodified DeltaStatus = iota
+	DeltaAdded
+	DeltaDeleted
+	DeltaModified
+	DeltaRenamed
+	DeltaCopied
+	DeltaIgnored
+	DeltaUntracked
+	DeltaTypeChange
+	DeltaUnreadable
+	DeltaConflicted
+)
+
+// FileMode is the mode of a file as it is recorded in a tree or the index
+type FileMode uint16
+
+// The set of file modes that git records
+const (
+	FileModeUnreadable     FileMode = 0
+	FileModeTree           FileMode = 0040000
+	FileModeBlob           FileMode = 0100644
+	FileModeBlobExecutable FileMode = 0100755
+	FileModeLink           FileMode = 0120000
+	FileModeCommit         FileMode = 0160000
+)
+
+// DiffFlag holds the flags of a diff file or a delta
+type DiffFlag uint32
+
+// The set of supported DiffFlags, same values with the lib's flags
+const (
+	DiffFlagBinary DiffFlag = 1 << iota
+	DiffFlagNotBinary
+	DiffFlagValidOid
+	DiffFlagExists
+)
+
 type DiffDelta struct {
-	Status  int
-	OldFile *DiffFile
-	NewFile *DiffFile
-	Patch   string
+	Status     DeltaStatus
+	Flags      DiffFlag
+	Similarity int
+	OldFile    *DiffFile
+	NewFile    *DiffFile
+	Patch      string
+}
+
+type DiffFile struct {
+	Path  string
+	Hash  string
+	Mode  FileMode
+	Size  int
+	Flags DiffFlag
+}
+
+// newDiffDelta converts the lib's delta into our wrapper
+func newDiffDelta(dd lib.DiffDelta) *DiffDelta {
+	return &DiffDelta{
+		Status:     DeltaStatus(dd.Status),
+		Flags:      DiffFlag(dd.Flags),
+		Similarity: int(dd.Similarity),
+		OldFile:    newDiffFile(dd.OldFile),
+		NewFile:    newDiffFile(dd.NewFile),
+	}
+}
+
+func newDiffFile(df lib.DiffFile) *DiffFile {
+	f := &DiffFile{
+		Path:  df.Path,
+		Mode:  FileMode(df.Mode),
+		Size:  df.Size,
+		Flags: DiffFlag(df.Flags),
+	}
+	if df.Oid != nil {
+		f.Hash = df.Oid.String()
+	}
+	return f
 }
 
 func (d *DiffDelta) String() string {
 	var s string
-	s = s + deltaType(d.Status) + " " // strconv.Itoa(d.Status) + " "
+	s = s + d.Status.Short() + " "
 	if len(d.OldFile.Path) > 0 && len(d.NewFile.Path) > 0 {
 		if d.OldFile.Path == d.NewFile.Path {
-			s = s + d.OldFile.Path //+ " " + d.OldFile.Hash[:7] + ".." + d.NewFile.Hash[:7]
+			s = s + d.OldFile.Path
 		} else {
 			s = s + d.OldFile.Path + " -> " + d.NewFile.Path
+			if d.Status == DeltaRenamed || d.Status == DeltaCopied {
+				s = s + " (" + strconv.Itoa(d.Similarity) + "%)"
+			}
 		}
 	}
+	if d.ModeChanged() {
+		s = s + " (" + d.OldFile.Mode.String() + " → " + d.NewFile.Mode.String() + ")"
+	} else if kind := d.NewFile.Mode.Kind(); len(kind) > 0 {
+		s = s + " [" + kind + "]"
+	}
 	return s
 }
 
+// ModeChanged is true if both sides of the delta exist and their modes differ
+func (d *DiffDelta) ModeChanged() bool {
+	return d.OldFile.Mode != FileModeUnreadable &&
+		d.NewFile.Mode != FileModeUnreadable &&
+		d.OldFile.Mode != d.NewFile.Mode
+}
+
+// Binary is true if the lib decided that the delta contains binary data
+func (d *DiffDelta) Binary() bool {
+	return d.Flags&DiffFlagBinary != 0
+}
+
+// Exists is true if the file is present on that side of the delta
+func (f *DiffFile) Exists() bool {
+	return f.Flags&DiffFlagExists != 0
+}
+
+// ValidHash is true if the hash of the file is known
+func (f *DiffFile) ValidHash() bool {
+	return f.Flags&DiffFlagValidOid != 0
+}
+
+// String returns the mode in octal form as git prints it e.g. 100644
+func (m FileMode) String() string {
+	// padded like "git ls-tree" e.g. 040000 for directories
+	s := strconv.FormatUint(uint64(m), 8)
+	if len(s) < 6 {
+		s = strings.Repeat("0", 6-len(s)) + s
+	}
+	return s
+}
+
+// Kind returns a label for the modes that are not regular files
+func (m FileMode) Kind() string {
+	switch m {
+	case FileModeLink:
+		return "symlink"
+	case FileModeCommit:
+		return "submodule"
+	case FileModeTree:
+		return "tree"
+	default:
+		return ""
+	}
+}
+
+// Short returns a single letter for the status, similar to "git diff --name-status"
+func (s DeltaStatus) Short() string {
+	switch s {
+	case DeltaUnmodified:
+		return "u"
+	case DeltaAdded:
+		return "a"
+	case DeltaDeleted:
+		return "d"
+	case DeltaModified:
+		return "m"
+	case DeltaRenamed:
+		return "r"
+	case DeltaCopied:
+		return "c"
+	case DeltaIgnored:
+		return "i"
+	case DeltaUntracked:
+		return "?"
+	case DeltaTypeChange:
+		return "t"
+	case DeltaUnreadable:
+		return "x"
+	case DeltaConflicted:
+		return "!"
+	default:
+		return ""
+	}
+}
+
+// String returns the status in pretty format
+func (s DeltaStatus) String() string {
+	switch s {
+	case DeltaUnmodified:
+		return "Unmodified"
+	case DeltaAdded:
+		return "Added"
+	case DeltaDeleted:
+		return "Deleted"
+	case DeltaModified:
+		return "Modified"
+	case DeltaRenamed:
+		return "Renamed"
+	case DeltaCopied:
+		return "Copied"
+	case DeltaIgnored:
+		return "Ignored"
+	case DeltaUntracked:
+		return "Untracked"
+	case DeltaTypeChange:
+		return "Type change"
+	case DeltaUnreadable:
+		return "Unreadable"
+	case DeltaConflicted:
+		return "Conflicted"
+	default:
+		return "Unknown"
+	}
+}
+
 // colorize the plain diff text collected from system output
 // the style is near to original diff command
 func colorizeDiff(original string) (colorized []string) {
@@ -76,50 +321,19 @@ func colorizeDiff(original string) (colorized []string) {
 	return colorized
 }
 
+// PatchString returns the colorized patch of the delta
 func (d *DiffDelta) PatchString() string {
+	if d.Binary() && len(d.Patch) == 0 {
+		return "Binary file " + d.NewFile.Path + " differs"
+	}
 	return strings.Join(colorizeDiff(d.Patch), "\n")
 }
 
-type DiffFile struct {
-	Path string
-	Hash string
-}
-
-func deltaType(i int) string {
-	switch i {
-	case 0:
-		return "u"
-	case 1:
-		return "a"
-
-	case 2:
-		return "d"
-
-	case 3:
-		return "m"
-
-	case 4:
-		return "r"
-
-	case 5:
-		return "c"
-
-	case 6:
-		return "i"
-
-	case 7:
-		return "?"
-
-	case 8:
-		return "!"
-
-	case 9:
-		return "x"
-
-	case 10:
-		return "x"
-	default:
-		return ""
+// PatchString returns the colorized patches of the diff
+func (d *Diff) PatchString() string {
+	patches := make([]string, 0)
+	for _, delta := range d.deltas {
+		patches = append(patches, delta.PatchString())
 	}
-
+	return strings.Join(patches, "\n")
 }
@@ -0,0 +1,210 @@
+package git
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	lib "gopkg.in/libgit2/git2go.v27"
+)
+
+// GrepMatch is a line that matches the pattern, binary files match as a
+// whole like "git grep" reports them
+type GrepMatch struct {
+	Path string
+	// Line starts from 1, it is 0 for binary files
+	Line   int
+	Text   string
+	Binary bool
+	// Revision is the commit that is searched, it is empty for the working
+	// dir
+	Revision string
+	// Hash is the blob of the file in the revision
+	Hash string
+}
+
+func (m *GrepMatch) String() string {
+	if m.Binary {
+		return "Binary file " + m.Path + " matches"
+	}
+	return m.Path + ":" + strconv.Itoa(m.Line) + ": " + strings.TrimSpace(m.Text)
+}
+
+// Grep searches the tracked files in the working dir, or the files in the
+// tree of the commit if it is given, for the lines that match the regular
+// expression. Only the paths matching one of the pathspecs are searched if
+// there are any.
+func (r *Repository) Grep(re *regexp.Regexp, c *Commit, pathspecs []string) ([]*GrepMatch, error) {
+	if c == nil {
+		if r.IsBare() {
+			return nil, ErrBareRepository
+		}
+		return r.grepWorkdir(re, pathspecs)
+	}
+	tree, err := c.commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	defer tree.Free()
+	matches := make([]*GrepMatch, 0)
+	var walkErr error
+	err = tree.Walk(func(root string, te *lib.TreeEntry) int {
+		if te.Type != lib.ObjectBlob {
+			return 0
+		}
+		p := path.Join(root, te.Name)
+		if !MatchPathspecs(p, pathspecs) {
+			return 0
+		}
+		blob, err := r.repo.LookupBlob(te.Id)
+		if err != nil {
+			walkErr = err
+			return -1
+		}
+		found := grepContent(re, p, blob.Contents())
+		blob.Free()
+		for _, m := range found {
+			m.Revision = c.Hash
+			m.Hash = te.Id.String()
+		}
+		matches = append(matches, found...)
+		return 0
+	})
+	if walkErr != nil {
+		return nil, walkErr
+	}
+	return matches, err
+}
+
+// grepWorkdir searches the files in the index as they are in the working
+// dir, files removed from the working dir are skipped
+func (r *Repository) grepWorkdir(re *regexp.Regexp, pathspecs []string) ([]*GrepMatch, error) {
+	index, err := r.repo.Index()
+	if err != nil {
+		return nil, err
+	}
+	defer index.Free()
+	matches := make([]*GrepMatch, 0)
+	count := index.EntryCount()
+	seen := make(map[string]bool)
+	for i := uint(0); i < count; i++ {
+		entry, err := index.EntryByIndex(i)
+		if err != nil {
+			return nil, err
+		}
+		// conflicted files have an entry for each stage
+		if seen[entry.Path] || !MatchPathspecs(entry.Path, pathspecs) {
+			continue
+		}
+		seen[entry.Path] = true
+		if FileMode(entry.Mode) == FileModeCommit || FileMode(entry.Mode) == FileModeLink {
+			continue
+		}
+		content, err := ioutil.ReadFile(filepath.Join(r.repo.Workdir(), entry.Path))
+		if err != nil {
+			continue
+		}
+		matches = append(matches, grepContent(re, entry.Path, content)...)
+	}
+	return matches, nil
+}
+
+// grepContent returns the matching lines of the content
+func grepContent(re *regexp.Regexp, p string, content []byte) []*GrepMatch {
+	matches := make([]*GrepMatch, 0)
+	head := content
+	if len(head) > 8000 {
+		head = head[:8000]
+	}
+	if bytes.IndexByte(head, 0) >= 0 {
+		if re.Match(content) {
+			matches = append(matches, &GrepMatch{
+				Path:   p,
+				Binary: true,
+			})
+		}
+		return matches
+	}
+	for i, line := range bytes.Split(content, []byte("\n")) {
+		if re.Match(line) {
+			matches = append(matches, &GrepMatch{
+				Path: p,
+				Line: i + 1,
+				Text: string(line),
+			})
+		}
+	}
+	return matches
+}
+
+// GrepContent returns the whole content of the file of the match
+func (r *Repository) GrepContent(m *GrepMatch) (string, error) {
+	if len(m.Revision) == 0 {
+		content, err := ioutil.ReadFile(filepath.Join(r.repo.Workdir(), m.Path))
+		return string(content), err
+	}
+	oid, err := lib.NewOid(m.Hash)
+	if err != nil {
+		return "", err
+	}
+	blob, err := r.repo.LookupBlob(oid)
+	if err != nil {
+		return "", err
+	}
+	defer blob.Free()
+	return string(blob.Contents()), nil
+}
+
+// MatchPathspecs is true if there are no pathspecs or the path matches one
+// of them and none of the excluding ones. A pathspec matches the path
+// itself, the files under it if it is a directory or the paths that match
+// it as a glob. Globs without a slash are matched against the file name.
+// Pathspecs starting with ":!" or ":^" exclude the paths they match.
+func MatchPathspecs(p string, pathspecs []string) bool {
+	included := true
+	for _, spec := range pathspecs {
+		if !isExcluding(spec) {
+			included = false
+			break
+		}
+	}
+	for _, spec := range pathspecs {
+		if isExcluding(spec) {
+			if matchPathspec(p, spec[2:]) {
+				return false
+			}
+			continue
+		}
+		if !included && matchPathspec(p, spec) {
+			included = true
+		}
+	}
+	return included
+}
+
+func isExcluding(spec string) bool {
+	return strings.HasPrefix(spec, ":!") || strings.HasPrefix(spec, ":^")
+}
+
+func matchPathspec(p, spec string) bool {
+	spec = strings.TrimPrefix(spec, "./")
+	spec = strings.TrimSuffix(spec, "/")
+	if len(spec) == 0 || spec == "." {
+		return true
+	}
+	if p == spec || strings.HasPrefix(p, spec+"/") {
+		return true
+	}
+	if ok, _ := path.Match(spec, p); ok {
+		return true
+	}
+	if !strings.Contains(spec, "/") {
+		ok, _ := path.Match(spec, path.Base(p))
+		return ok
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package git
+
+import (
+	"errors"
+	"strings"
+
+	lib "gopkg.in/libgit2/git2go.v27"
+)
+
+// HeadState is the kind of the reference that HEAD points to
+type HeadState uint8
+
+const (
+	// HeadOnBranch is the usual state, HEAD points to a local branch
+	HeadOnBranch HeadState = iota
+	// HeadDetached is the state when HEAD points directly to a commit
+	HeadDetached
+	// HeadUnborn is the state when HEAD points to a branch that has no
+	// commits yet e.g. in a freshly initialized repository
+	HeadUnborn
+)
+
+// Head is the current position of the repository
+type Head struct {
+	State HeadState
+	// Branch is the short name of the checked out branch, it is empty if
+	// HEAD is detached
+	Branch string
+	// Hash is the targeted commit, it is empty if HEAD is unborn
+	Hash string
+}
+
+// ErrUnbornHead is returned when an operation needs a commit but the
+// current branch has no commits yet
+var ErrUnbornHead = errors.New("the current branch does not have any commits yet")
+
+// loadHead reads what HEAD points to
+func (r *Repository) loadHead() error {
+	unborn, err := r.repo.IsHeadUnborn()
+	if err != nil {
+		return err
+	}
+	if unborn {
+		ref, err := r.repo.References.Lookup("HEAD")
+		if err != nil {
+			return err
+		}
+		defer ref.Free()
+		r.Head = &Head{
+			State:  HeadUnborn,
+			Branch: strings.TrimPrefix(ref.SymbolicTarget(), "refs/heads/"),
+		}
+		return nil
+	}
+	detached, err := r.repo.IsHeadDetached()
+	if err != nil {
+		return err
+	}
+	ref, err := r.repo.Head()
+	if err != nil {
+		return err
+	}
+	defer ref.Free()
+	head := &Head{
+		State: HeadOnBranch,
+		Hash:  ref.Target().String(),
+	}
+	if detached {
+		head.State = HeadDetached
+	} else {
+		head.Branch = ref.Shorthand()
+	}
+	r.Head = head
+	return nil
+}
+
+// ShortHash returns the abbreviated hash of the targeted commit
+func (h *Head) ShortHash() string {
+	if len(h.Hash) > 7 {
+		return h.Hash[:7]
+	}
+	return h.Hash
+}
+
+// String returns a description similar to the first line of "git status"
+func (h *Head) String() string {
+	switch h.State {
+	case HeadDetached:
+		return "HEAD detached at " + h.ShortHash()
+	case HeadUnborn:
+		return "On branch " + h.Branch + ", no commits yet"
+	default:
+		return "On branch " + h.Branch
+	}
+}
@@ -0,0 +1,179 @@
+package git
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// IgnoreTarget is the file that an ignore rule is written to
+type IgnoreTarget int
+
+// The files that git reads the ignore rules from
+const (
+	// IgnoreShared is the .gitignore at the top of the working dir
+	IgnoreShared IgnoreTarget = iota
+	// IgnoreLocal is the .git/info/exclude which is not committed
+	IgnoreLocal
+	// IgnoreGlobal is the core.excludesFile of the user
+	IgnoreGlobal
+)
+
+// IgnoreTargets lists every target in the order of their scope
+var IgnoreTargets = []IgnoreTarget{IgnoreShared, IgnoreLocal, IgnoreGlobal}
+
+func (t IgnoreTarget) String() string {
+	switch t {
+	case IgnoreShared:
+		return ".gitignore"
+	case IgnoreLocal:
+		return ".git/info/exclude"
+	case IgnoreGlobal:
+		return "global excludes file"
+	default:
+		return "unknown"
+	}
+}
+
+// IgnoreMatch is the rule that causes a path to be ignored
+type IgnoreMatch struct {
+	Source  string
+	Line    int
+	Pattern string
+}
+
+func (m *IgnoreMatch) String() string {
+	return m.Source + ":" + strconv.Itoa(m.Line) + ": " + m.Pattern
+}
+
+// IgnorePatterns suggests patterns to ignore the entry with; the path
+// itself, every file with the same extension and the directory it is in
+func (e *StatusEntry) IgnorePatterns() []string {
+	p := e.Path()
+	patterns := []string{"/" + escapePattern(p)}
+	if e.UntrackedDir() {
+		p = strings.TrimSuffix(p, "/")
+	} else if ext := path.Ext(p); len(ext) > 0 {
+		patterns = append(patterns, "*"+escapePattern(ext))
+	}
+	if dir := path.Dir(p); dir != "." {
+		patterns = append(patterns, "/"+escapePattern(dir)+"/")
+	}
+	return patterns
+}
+
+// escapePattern quotes the characters that have a meaning in an ignore
+// pattern, and the leading and trailing spaces which git would trim
+func escapePattern(p string) string {
+	var b strings.Builder
+	for _, c := range p {
+		if strings.ContainsRune("\\*?[]!#", c) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(c)
+	}
+	escaped := b.String()
+	trimmed := strings.TrimRight(escaped, " ")
+	trailing := len(escaped) - len(trimmed)
+	escaped = strings.TrimLeft(trimmed, " ")
+	leading := len(trimmed) - len(escaped)
+	return strings.Repeat("\\ ", leading) + escaped + strings.Repeat("\\ ", trailing)
+}
+
+// Ignore appends the pattern to the ignore file of the target
+func (r *Repository) Ignore(pattern string, target IgnoreTarget) error {
+	name, err := r.ignoreFile(target)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	content, err := ioutil.ReadFile(name)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	file, err := os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if len(content) > 0 && content[len(content)-1] != '\n' {
+		pattern = "\n" + pattern
+	}
+	if _, err := file.WriteString(pattern + "\n"); err != nil {
+		return err
+	}
+	return r.loadStatus()
+}
+
+// ignoreFile returns the path of the ignore file of the target
+func (r *Repository) ignoreFile(target IgnoreTarget) (string, error) {
+	switch target {
+	case IgnoreShared:
+		return filepath.Join(r.repo.Workdir(), ".gitignore"), nil
+	case IgnoreLocal:
+		return filepath.Join(r.repo.Path(), "info", "exclude"), nil
+	case IgnoreGlobal:
+		return r.globalExcludesFile()
+	}
+	return "", errors.New("unknown ignore target")
+}
+
+// globalExcludesFile reads core.excludesFile from the config, if it is not
+// set git's default location is used
+func (r *Repository) globalExcludesFile() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	config, err := r.repo.Config()
+	if err != nil {
+		return "", err
+	}
+	defer config.Free()
+	if name, err := config.LookupString("core.excludesfile"); err == nil && len(name) > 0 {
+		if strings.HasPrefix(name, "~/") {
+			name = filepath.Join(home, name[2:])
+		}
+		return name, nil
+	}
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); len(xdg) > 0 {
+		return filepath.Join(xdg, "git", "ignore"), nil
+	}
+	return filepath.Join(home, ".config", "git", "ignore"), nil
+}
+
+// ExplainIgnore finds the rule that ignores the path, it is the wrapper
+// of "git check-ignore --verbose" since the lib can't tell the source
+func (r *Repository) ExplainIgnore(p string) (*IgnoreMatch, error) {
+	cmd := exec.Command("git", "check-ignore", "--verbose", "--no-index", "-z", "--", p)
+	cmd.Dir = r.repo.Workdir()
+	out, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+			return nil, errors.New(p + " is not ignored")
+		}
+		return nil, err
+	}
+	// the output is "<source> NUL <line> NUL <pattern> NUL <path> NUL", the
+	// fields may contain colons e.g. in Windows paths
+	parts := strings.Split(string(out), "\x00")
+	if len(parts) < 3 {
+		return nil, errors.New("unexpected output: " + string(out))
+	}
+	n, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	return &IgnoreMatch{
+		Source:  parts[0],
+		Line:    n,
+		Pattern: parts[2],
+	}, nil
+}
@@ -0,0 +1,214 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+
+	lib "gopkg.in/libgit2/git2go.v27"
+)
+
+// AddEntry stages the change of the entry, it is the equivalent of
+// "git add /path/to/file" but deletions and renames are staged as well
+func (r *Repository) AddEntry(e *StatusEntry) error {
+	err := r.Record("add "+e.Path(), nil, func() error {
+		index, err := r.repo.Index()
+		if err != nil {
+			return err
+		}
+		defer index.Free()
+
+		if err := r.addToIndex(index, e); err != nil {
+			return err
+		}
+		return index.Write()
+	})
+	if err != nil {
+		return err
+	}
+	return r.loadStatus()
+}
+
+// ResetEntry restores the index entries of the paths to their HEAD
+// versions, it is the equivalent of "git reset HEAD -- path/to/file"
+func (r *Repository) ResetEntry(e *StatusEntry) error {
+	err := r.Record("reset "+e.Path(), nil, func() error {
+		return r.resetPaths(e.paths())
+	})
+	if err != nil {
+		return err
+	}
+	return r.loadStatus()
+}
+
+// AddEntries stages the changes of the entries with a single index write,
+// so that staging e.g. a whole directory is logged as one operation
+func (r *Repository) AddEntries(name string, entries []*StatusEntry) error {
+	err := r.Record("add "+name, nil, func() error {
+		index, err := r.repo.Index()
+		if err != nil {
+			return err
+		}
+		defer index.Free()
+
+		for _, e := range entries {
+			if err := r.addToIndex(index, e); err != nil {
+				return err
+			}
+		}
+		return index.Write()
+	})
+	if err != nil {
+		return err
+	}
+	return r.loadStatus()
+}
+
+// ResetEntries restores the index entries of the entries to their HEAD
+// versions with a single index write and logs them as one operation
+func (r *Repository) ResetEntries(name string, entries []*StatusEntry) error {
+	paths := make([]string, 0)
+	for _, e := range entries {
+		paths = append(paths, e.paths()...)
+	}
+	err := r.Record("reset "+name, nil, func() error {
+		return r.resetPaths(paths)
+	})
+	if err != nil {
+		return err
+	}
+	return r.loadStatus()
+}
+
+// AddAll stages every change in the working dir including deletions, it is
+// the equivalent of "git add --all"
+func (r *Repository) AddAll() error {
+	err := r.Record("add all", nil, func() error {
+		index, err := r.repo.Index()
+		if err != nil {
+			return err
+		}
+		defer index.Free()
+
+		if err := index.AddAll([]string{}, lib.IndexAddDefault, nil); err != nil {
+			return err
+		}
+		if err := index.UpdateAll([]string{}, nil); err != nil {
+			return err
+		}
+		return index.Write()
+	})
+	if err != nil {
+		return err
+	}
+	return r.loadStatus()
+}
+
+// ResetAll restores the whole index to HEAD, it is the equivalent of
+// "git reset --mixed"
+func (r *Repository) ResetAll() error {
+	err := r.Record("reset all", nil, func() error {
+		return r.resetPaths([]string{})
+	})
+	if err != nil {
+		return err
+	}
+	return r.loadStatus()
+}
+
+// addToIndex writes the working dir side of the entry to the index
+func (r *Repository) addToIndex(index *lib.Index, e *StatusEntry) error {
+	oldPath := e.diffDelta.OldFile.Path
+	newPath := e.diffDelta.NewFile.Path
+	switch e.statusEntryType {
+	case StatusEntryTypeDeleted:
+		return index.RemoveByPath(oldPath)
+	case StatusEntryTypeRenamed:
+		if err := index.RemoveByPath(oldPath); err != nil {
+			return err
+		}
+		return index.AddByPath(newPath)
+	case StatusEntryTypeConflicted:
+		// adding a path resolves the conflict, if the file is removed
+		// while resolving, then the resolution is a deletion
+		if _, err := os.Lstat(filepath.Join(r.repo.Workdir(), newPath)); os.IsNotExist(err) {
+			return index.RemoveByPath(newPath)
+		}
+		return index.AddByPath(newPath)
+	case StatusEntryTypeUntracked:
+		// untracked directories are reported as a single entry
+		if e.UntrackedDir() {
+			return index.AddAll([]string{newPath}, lib.IndexAddDefault, nil)
+		}
+		return index.AddByPath(newPath)
+	case StatusEntryTypeIgnored:
+		// the lib adds the path without checking the ignore rules, an
+		// ignored file is never force added
+		return nil
+	default:
+		return index.AddByPath(newPath)
+	}
+}
+
+// resetPaths restores the paths in the index to their HEAD versions, if
+// there are no paths the whole index is restored. Paths that do not exist
+// in HEAD are removed from the index.
+func (r *Repository) resetPaths(paths []string) error {
+	commit, err := r.headCommit()
+	if err != nil {
+		return err
+	}
+	if commit != nil {
+		defer commit.Free()
+		return r.repo.ResetDefaultToCommit(commit, paths)
+	}
+	// there is nothing to reset to on an unborn branch, so everything
+	// staged is removed
+	index, err := r.repo.Index()
+	if err != nil {
+		return err
+	}
+	defer index.Free()
+	if len(paths) == 0 {
+		if err := index.Clear(); err != nil {
+			return err
+		}
+	} else {
+		for _, path := range paths {
+			if err := index.RemoveByPath(path); err != nil {
+				return err
+			}
+		}
+	}
+	return index.Write()
+}
+
+// headCommit returns the commit that HEAD points to, it is nil if HEAD is
+// unborn
+func (r *Repository) headCommit() (*lib.Commit, error) {
+	unborn, err := r.repo.IsHeadUnborn()
+	if err != nil {
+		return nil, err
+	}
+	if unborn {
+		return nil, nil
+	}
+	head, err := r.repo.Head()
+	if err != nil {
+		return nil, err
+	}
+	defer head.Free()
+	return r.repo.LookupCommit(head.Target())
+}
+
+// paths returns the distinct paths that the entry touches
+func (e *StatusEntry) paths() []string {
+	oldPath := e.diffDelta.OldFile.Path
+	newPath := e.diffDelta.NewFile.Path
+	if len(oldPath) == 0 || oldPath == newPath {
+		return []string{newPath}
+	}
+	if len(newPath) == 0 {
+		return []string{oldPath}
+	}
+	return []string{oldPath, newPath}
+}
@@ -0,0 +1,478 @@
+package git
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	lib "gopkg.in/libgit2/git2go.v27"
+)
+
+// maxOperations is the number of operations kept in the log
+const maxOperations = 100
+
+// symbolicPrefix marks the value of a symbolic reference in the log
+const symbolicPrefix = "ref: "
+
+// Operation is a mutating action taken by gitin, it holds the state of the
+// index and the refs before and after the action so that it can be undone
+type Operation struct {
+	Name        string      `json:"name"`
+	Time        time.Time   `json:"time"`
+	IndexBefore string      `json:"index_before,omitempty"`
+	IndexAfter  string      `json:"index_after,omitempty"`
+	Refs        []RefChange `json:"refs,omitempty"`
+	Undone      bool        `json:"undone,omitempty"`
+	// Autostash is the hash of the stash that a checkout could not apply
+	// back, undoing the operation applies it
+	Autostash string `json:"autostash,omitempty"`
+}
+
+// RefChange is the value of a ref before and after an operation; it is
+// a hash, or the target of a symbolic ref or empty if the ref is missing
+type RefChange struct {
+	Name   string `json:"name"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+func (o *Operation) String() string {
+	return o.Name + " (" + o.Time.Format(time.RFC3339) + ")"
+}
+
+// ErrNothingToUndo is returned when the operation log is exhausted
+var ErrNothingToUndo = errors.New("nothing to undo")
+
+// ErrNothingToRedo is returned when there is no undone operation
+var ErrNothingToRedo = errors.New("nothing to redo")
+
+// Record runs the action and logs the changes it makes to the index and
+// to the given refs. If HEAD is one of the refs, the branch it points to
+// is recorded as well.
+func (r *Repository) Record(name string, refs []string, action func() error) error {
+	for _, ref := range refs {
+		if ref == "HEAD" {
+			if target, err := r.readRef("HEAD"); err == nil && strings.HasPrefix(target, symbolicPrefix) {
+				refs = append(refs, strings.TrimPrefix(target, symbolicPrefix))
+			}
+		}
+	}
+	op := &Operation{
+		Name: name,
+		Time: time.Now(),
+		Refs: make([]RefChange, 0),
+	}
+	// snapshots may fail e.g. if the index has conflicts, the operation is
+	// still carried out but only the parts that can be restored are logged
+	op.IndexBefore, _ = r.snapshotIndex()
+	before := make([]string, len(refs))
+	for i, ref := range refs {
+		before[i], _ = r.readRef(ref)
+	}
+	if err := action(); err != nil {
+		return err
+	}
+	op.IndexAfter, _ = r.snapshotIndex()
+	for i, ref := range refs {
+		after, _ := r.readRef(ref)
+		if after != before[i] {
+			op.Refs = append(op.Refs, RefChange{
+				Name:   ref,
+				Before: before[i],
+				After:  after,
+			})
+		}
+	}
+	if op.IndexBefore == op.IndexAfter && len(op.Refs) == 0 {
+		return nil
+	}
+	ops, err := r.readOperations()
+	if err != nil {
+		return err
+	}
+	// a new operation discards the ones that can be redone
+	kept := make([]*Operation, 0)
+	for _, o := range ops {
+		if !o.Undone {
+			kept = append(kept, o)
+		}
+	}
+	kept = append(kept, op)
+	if len(kept) > maxOperations {
+		kept = kept[len(kept)-maxOperations:]
+	}
+	return r.writeOperations(kept)
+}
+
+// Operations returns the logged operations, the latest is the last
+func (r *Repository) Operations() ([]*Operation, error) {
+	return r.readOperations()
+}
+
+// Undo restores the index and refs to their state before the last
+// operation that is not undone yet
+func (r *Repository) Undo() (*Operation, error) {
+	ops, err := r.readOperations()
+	if err != nil {
+		return nil, err
+	}
+	for i := len(ops) - 1; i >= 0; i-- {
+		if ops[i].Undone {
+			continue
+		}
+		op := ops[i]
+		if err := r.restorable(op, true); err != nil {
+			return nil, err
+		}
+		if err := r.restore(op, true); err != nil {
+			return nil, err
+		}
+		op.Undone = true
+		if err := r.writeOperations(ops); err != nil {
+			return nil, err
+		}
+		if len(op.Autostash) == 0 {
+			return op, nil
+		}
+		if err := r.applyAutostash(op.Autostash); err != nil {
+			return op, err
+		}
+		return op, r.loadStatus()
+	}
+	return nil, ErrNothingToUndo
+}
+
+// Redo applies the earliest undone operation again
+func (r *Repository) Redo() (*Operation, error) {
+	ops, err := r.readOperations()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range ops {
+		if !op.Undone {
+			continue
+		}
+		if err := r.restorable(op, false); err != nil {
+			return nil, err
+		}
+		// the changes that the undo applied are stashed again like the
+		// operation did, so that the checkout does not fail on them
+		stash := ""
+		if len(op.Autostash) > 0 {
+			if stash, err = r.stashLocalChanges("gitin: autostash before redoing " + op.Name); err != nil {
+				return nil, err
+			}
+		}
+		if err := r.restore(op, false); err != nil {
+			if len(stash) > 0 {
+				r.applyAutostash(stash)
+			}
+			return nil, err
+		}
+		op.Undone = false
+		op.Autostash = ""
+		var stashErr error
+		if len(stash) > 0 {
+			if stashErr = r.applyAutostash(stash); stashErr != nil {
+				op.Autostash = stash
+			}
+		}
+		if err := r.writeOperations(ops); err != nil {
+			return nil, err
+		}
+		if stashErr != nil {
+			return op, stashErr
+		}
+		return op, r.loadStatus()
+	}
+	return nil, ErrNothingToRedo
+}
+
+// restorable returns an error if the operation cannot be undone or redone,
+// the index must be recorded and the index and the refs must be as the
+// operation left them, or as they were before it for a redo. Otherwise they
+// are changed outside of gitin and restoring would overwrite the changes.
+func (r *Repository) restorable(op *Operation, undo bool) error {
+	if len(op.IndexBefore) == 0 || len(op.IndexAfter) == 0 {
+		return errors.New("the index is not recorded for " + op.Name + ", it cannot be restored")
+	}
+	snapshot := op.IndexAfter
+	if !undo {
+		snapshot = op.IndexBefore
+	}
+	current, err := r.snapshotIndex()
+	if err != nil {
+		return err
+	}
+	if current != snapshot {
+		return errors.New("the index is changed since " + op.Name)
+	}
+	for _, ref := range op.Refs {
+		value := ref.After
+		if !undo {
+			value = ref.Before
+		}
+		current, err := r.readRef(ref.Name)
+		if err != nil {
+			return err
+		}
+		if current != value {
+			return errors.New(ref.Name + " is changed since " + op.Name)
+		}
+	}
+	return nil
+}
+
+// restore sets the index and the refs to their values before or after the
+// operation
+func (r *Repository) restore(op *Operation, before bool) error {
+	snapshot := op.IndexAfter
+	if before {
+		snapshot = op.IndexBefore
+	}
+	values := make(map[string]string)
+	switched := false
+	for _, ref := range op.Refs {
+		values[ref.Name] = ref.After
+		if before {
+			values[ref.Name] = ref.Before
+		}
+		// a commit on a detached HEAD only moves it, the working dir is
+		// checked out when HEAD is switched to or from a branch
+		if ref.Name == "HEAD" && (strings.HasPrefix(ref.Before, symbolicPrefix) || strings.HasPrefix(ref.After, symbolicPrefix)) {
+			switched = true
+		}
+	}
+	if switched {
+		if err := r.checkoutRestored(values["HEAD"], values); err != nil {
+			return err
+		}
+	}
+	for _, ref := range op.Refs {
+		if err := r.writeRef(ref.Name, values[ref.Name]); err != nil {
+			return err
+		}
+	}
+	if err := r.restoreIndex(snapshot); err != nil {
+		return err
+	}
+	return r.loadStatus()
+}
+
+// checkoutRestored brings the working dir to the commit that the restored
+// HEAD points to, local changes are kept. It runs before HEAD is moved so
+// that the current HEAD is the baseline of the checkout, like in switchTo.
+func (r *Repository) checkoutRestored(head string, values map[string]string) error {
+	target := head
+	if strings.HasPrefix(head, symbolicPrefix) {
+		name := strings.TrimPrefix(head, symbolicPrefix)
+		v, ok := values[name]
+		if !ok {
+			var err error
+			if v, err = r.readRef(name); err != nil {
+				return err
+			}
+		}
+		target = v
+	}
+	// an unborn branch has nothing to check out
+	if len(target) == 0 || strings.HasPrefix(target, symbolicPrefix) {
+		return nil
+	}
+	oid, err := lib.NewOid(target)
+	if err != nil {
+		return err
+	}
+	commit, err := r.repo.LookupCommit(oid)
+	if err != nil {
+		return err
+	}
+	defer commit.Free()
+	tree, err := commit.Tree()
+	if err != nil {
+		return err
+	}
+	defer tree.Free()
+	opts := &lib.CheckoutOpts{
+		Strategy: lib.CheckoutSafe,
+	}
+	return r.repo.CheckoutTree(tree, opts)
+}
+
+// markAutostash notes the stash at the top of the stash list on the latest
+// operation so that undoing it applies the stash back
+func (r *Repository) markAutostash() error {
+	stash, err := r.readRef("refs/stash")
+	if err != nil || len(stash) == 0 {
+		return err
+	}
+	ops, err := r.readOperations()
+	if err != nil || len(ops) == 0 {
+		return err
+	}
+	ops[len(ops)-1].Autostash = stash
+	return r.writeOperations(ops)
+}
+
+// stashLocalChanges stashes the local changes with the untracked files and
+// returns the hash of the stash, it is empty if there is nothing to stash
+func (r *Repository) stashLocalChanges(msg string) (string, error) {
+	sig, err := r.repo.DefaultSignature()
+	if err != nil {
+		return "", err
+	}
+	oid, err := r.repo.Stashes.Save(sig, msg, lib.StashIncludeUntracked)
+	if err != nil {
+		if lib.IsErrorCode(err, lib.ErrNotFound) {
+			return "", nil
+		}
+		return "", err
+	}
+	return oid.String(), nil
+}
+
+// applyAutostash pops the stash with the hash, nothing is done if it is not
+// in the stash list anymore
+func (r *Repository) applyAutostash(hash string) error {
+	index := -1
+	err := r.repo.Stashes.Foreach(func(i int, msg string, id *lib.Oid) error {
+		if id.String() == hash {
+			index = i
+		}
+		return nil
+	})
+	if err != nil || index < 0 {
+		return err
+	}
+	opts, err := lib.DefaultStashApplyOptions()
+	if err != nil {
+		return err
+	}
+	if err := r.repo.Stashes.Pop(index, opts); err != nil {
+		return errors.New("local changes are kept in the stash, they could not be applied: " + err.Error())
+	}
+	return nil
+}
+
+// snapshotIndex writes the index as a tree and returns its hash
+func (r *Repository) snapshotIndex() (string, error) {
+	if r.repo.IsBare() {
+		return "", nil
+	}
+	index, err := r.repo.Index()
+	if err != nil {
+		return "", err
+	}
+	defer index.Free()
+	oid, err := index.WriteTree()
+	if err != nil {
+		return "", err
+	}
+	return oid.String(), nil
+}
+
+// restoreIndex reads the tree of the snapshot into the index
+func (r *Repository) restoreIndex(snapshot string) error {
+	oid, err := lib.NewOid(snapshot)
+	if err != nil {
+		return err
+	}
+	tree, err := r.repo.LookupTree(oid)
+	if err != nil {
+		return err
+	}
+	defer tree.Free()
+	index, err := r.repo.Index()
+	if err != nil {
+		return err
+	}
+	defer index.Free()
+	if err := index.ReadTree(tree); err != nil {
+		return err
+	}
+	return index.Write()
+}
+
+// readRef returns the hash or symbolic target of the ref, it is empty if
+// the ref does not exist
+func (r *Repository) readRef(name string) (string, error) {
+	ref, err := r.repo.References.Lookup(name)
+	if err != nil {
+		if lib.IsErrorCode(err, lib.ErrNotFound) {
+			return "", nil
+		}
+		return "", err
+	}
+	defer ref.Free()
+	if ref.Type() == lib.ReferenceSymbolic {
+		return symbolicPrefix + ref.SymbolicTarget(), nil
+	}
+	return ref.Target().String(), nil
+}
+
+// writeRef sets the ref to the value read by readRef before
+func (r *Repository) writeRef(name, value string) error {
+	msg := "gitin: undo"
+	if len(value) == 0 {
+		ref, err := r.repo.References.Lookup(name)
+		if err != nil {
+			return nil
+		}
+		defer ref.Free()
+		return ref.Delete()
+	}
+	if strings.HasPrefix(value, symbolicPrefix) {
+		ref, err := r.repo.References.CreateSymbolic(name, strings.TrimPrefix(value, symbolicPrefix), true, msg)
+		if err != nil {
+			return err
+		}
+		ref.Free()
+		return nil
+	}
+	oid, err := lib.NewOid(value)
+	if err != nil {
+		return err
+	}
+	if name == "HEAD" {
+		return r.repo.SetHeadDetached(oid)
+	}
+	ref, err := r.repo.References.Create(name, oid, true, msg)
+	if err != nil {
+		return err
+	}
+	ref.Free()
+	return nil
+}
+
+func (r *Repository) oplogPath() string {
+	return filepath.Join(r.repo.Path(), "gitin", "oplog.json")
+}
+
+func (r *Repository) readOperations() ([]*Operation, error) {
+	ops := make([]*Operation, 0)
+	data, err := ioutil.ReadFile(r.oplogPath())
+	if os.IsNotExist(err) {
+		return ops, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &ops); err != nil {
+		return nil, err
+	}
+	return ops, nil
+}
+
+func (r *Repository) writeOperations(ops []*Operation) error {
+	if err := os.MkdirAll(filepath.Dir(r.oplogPath()), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(ops, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(r.oplogPath(), data, 0644)
+}
@@ -0,0 +1,278 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	lib "gopkg.in/libgit2/git2go.v27"
+)
+
+// MailPatch is a patch read from a mailbox as "git format-patch" writes it
+type MailPatch struct {
+	From    string
+	Date    string
+	Subject string
+	// Raw is the whole mail including the headers
+	Raw string
+}
+
+// mboxSeparator is the first line of each mail written by format-patch,
+// the date is a fixed magic value
+var mboxSeparator = regexp.MustCompile(`^From [0-9a-f]{40} Mon Sep 17 00:00:00 2001$`)
+
+var patchPrefix = regexp.MustCompile(`^\[PATCH[^\]]*\]\s*`)
+
+func (p *MailPatch) String() string {
+	return p.Subject
+}
+
+// FormatPatch writes the commits as mbox files into the dir, it is the
+// equivalent of "git format-patch --numbered [--cover-letter]" for an
+// arbitrary list of commits. The commits should be given in the order they
+// will be applied, the paths of the written files are returned.
+func (r *Repository) FormatPatch(commits []*Commit, dir string, coverLetter bool) ([]string, error) {
+	if len(commits) == 0 {
+		return nil, errors.New("there are no commits to export")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	total := strconv.Itoa(len(commits))
+	files := make([]string, 0)
+	if coverLetter {
+		name := filepath.Join(dir, "0000-cover-letter.patch")
+		if err := ioutil.WriteFile(name, []byte(r.coverLetter(commits)), 0644); err != nil {
+			return nil, err
+		}
+		files = append(files, name)
+	}
+	for i, c := range commits {
+		cmd := exec.Command("git", "format-patch", "-1", "--stdout", c.Hash)
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, err
+		}
+		// format-patch numbers a single patch as [PATCH], it is replaced
+		// with the position in the series
+		prefix := "[PATCH " + strconv.Itoa(i+1) + "/" + total + "]"
+		mail := strings.Replace(string(out), "Subject: [PATCH]", "Subject: "+prefix, 1)
+		name := filepath.Join(dir, fmt.Sprintf("%04d-%s.patch", i+1, patchSlug(c.Summary)))
+		if err := ioutil.WriteFile(name, []byte(mail), 0644); err != nil {
+			return nil, err
+		}
+		files = append(files, name)
+	}
+	return files, nil
+}
+
+// coverLetter returns the cover letter of the series with a short log of
+// the commits grouped by author
+func (r *Repository) coverLetter(commits []*Commit) string {
+	from := commits[len(commits)-1].Author.String()
+	if sig, err := r.repo.DefaultSignature(); err == nil {
+		from = sig.Name + " <" + sig.Email + ">"
+	}
+	authors := make([]string, 0)
+	summaries := make(map[string][]string)
+	for _, c := range commits {
+		name := c.Author.Name
+		if _, ok := summaries[name]; !ok {
+			authors = append(authors, name)
+		}
+		summaries[name] = append(summaries[name], c.Summary)
+	}
+	var buf bytes.Buffer
+	buf.WriteString("From " + commits[len(commits)-1].Hash + " Mon Sep 17 00:00:00 2001\n")
+	buf.WriteString("From: " + from + "\n")
+	buf.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\n")
+	buf.WriteString("Subject: [PATCH 0/" + strconv.Itoa(len(commits)) + "] *** SUBJECT HERE ***\n\n")
+	buf.WriteString("*** BLURB HERE ***\n\n")
+	for _, name := range authors {
+		buf.WriteString(name + " (" + strconv.Itoa(len(summaries[name])) + "):\n")
+		for _, s := range summaries[name] {
+			buf.WriteString("  " + s + "\n")
+		}
+		buf.WriteString("\n")
+	}
+	buf.WriteString("-- \ngitin\n")
+	return buf.String()
+}
+
+// patchSlug turns the summary into a file name like format-patch does
+func patchSlug(summary string) string {
+	var slug []rune
+	dash := false
+	for _, c := range summary {
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '_' {
+			slug = append(slug, c)
+			dash = false
+		} else if !dash && len(slug) > 0 {
+			slug = append(slug, '-')
+			dash = true
+		}
+	}
+	if len(slug) > 52 {
+		slug = slug[:52]
+	}
+	return strings.Trim(string(slug), "-.")
+}
+
+// SplitMailbox reads the patches from the mbox file
+func SplitMailbox(path string) ([]*MailPatch, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	patches := make([]*MailPatch, 0)
+	var current *MailPatch
+	var raw bytes.Buffer
+	headers := false
+	flush := func() {
+		if current != nil {
+			current.Raw = raw.String()
+			patches = append(patches, current)
+		}
+		raw.Reset()
+	}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if mboxSeparator.MatchString(line) {
+			flush()
+			current = &MailPatch{}
+			headers = true
+		}
+		if current == nil {
+			continue
+		}
+		raw.WriteString(line + "\n")
+		if !headers {
+			continue
+		}
+		switch {
+		case len(line) == 0:
+			headers = false
+		case strings.HasPrefix(line, "From: "):
+			current.From = strings.TrimPrefix(line, "From: ")
+		case strings.HasPrefix(line, "Date: "):
+			current.Date = strings.TrimPrefix(line, "Date: ")
+		case strings.HasPrefix(line, "Subject: "):
+			current.Subject = strings.TrimPrefix(line, "Subject: ")
+		case strings.HasPrefix(line, " ") && len(current.Subject) > 0:
+			// folded subject
+			current.Subject = current.Subject + line
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+	if len(patches) == 0 {
+		return nil, errors.New(path + " does not contain any patches")
+	}
+	return patches, nil
+}
+
+// Title returns the subject without the [PATCH n/m] prefix
+func (p *MailPatch) Title() string {
+	return patchPrefix.ReplaceAllString(p.Subject, "")
+}
+
+// ApplyingMailbox is true if a "git am" session is in progress, e.g. a
+// patch failed to apply and waits to be resolved, skipped or aborted
+func (r *Repository) ApplyingMailbox() bool {
+	// the ambiguous "rebase-apply" state may be a rebase, it is not counted
+	return r.repo.State() == lib.RepositoryStateApplyMailbox
+}
+
+// ApplyPatch applies the patch and commits it with "git am --3way". If the
+// patch does not apply the am session is left in progress.
+func (r *Repository) ApplyPatch(p *MailPatch) error {
+	return r.am("apply "+p.Title(), p.Raw, "--3way")
+}
+
+// ContinueApply commits the resolved patch and goes on with the session
+func (r *Repository) ContinueApply() error {
+	return r.am("am --continue", "", "--continue")
+}
+
+// SkipPatch skips the patch that failed to apply
+func (r *Repository) SkipPatch() error {
+	return r.am("am --skip", "", "--skip")
+}
+
+// AbortApply ends the session and restores the branch to where it was
+// before the session has started, the pending patches are dropped
+func (r *Repository) AbortApply() error {
+	if err := r.am("am --abort", "", "--abort"); err != nil {
+		return err
+	}
+	return r.SavePendingPatches(nil)
+}
+
+// PendingPatches returns the patches of the series that are not applied
+// yet, they are kept while a failed patch waits to be resolved
+func (r *Repository) PendingPatches() ([]*MailPatch, error) {
+	if _, err := os.Stat(r.pendingPatchesPath()); os.IsNotExist(err) {
+		return nil, nil
+	}
+	return SplitMailbox(r.pendingPatchesPath())
+}
+
+// SavePendingPatches keeps the patches to be applied after the session is
+// resumed, the kept patches are removed if there are none
+func (r *Repository) SavePendingPatches(patches []*MailPatch) error {
+	name := r.pendingPatchesPath()
+	if len(patches) == 0 {
+		if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	var b strings.Builder
+	for _, p := range patches {
+		b.WriteString(p.Raw)
+	}
+	return ioutil.WriteFile(name, []byte(b.String()), 0644)
+}
+
+func (r *Repository) pendingPatchesPath() string {
+	return filepath.Join(r.repo.Path(), "gitin", "am-pending.mbox")
+}
+
+// am runs "git am" with the args, the mail is given from the stdin
+func (r *Repository) am(name, mail string, args ...string) error {
+	if r.IsBare() {
+		return ErrBareRepository
+	}
+	err := r.Record(name, []string{"HEAD"}, func() error {
+		cmd := exec.Command("git", append([]string{"am"}, args...)...)
+		if len(mail) > 0 {
+			cmd.Stdin = strings.NewReader(mail)
+		}
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			return errors.New(strings.TrimSpace(string(out)))
+		}
+		return nil
+	})
+	if lerr := r.loadStatus(); err == nil {
+		err = lerr
+	}
+	return err
+}
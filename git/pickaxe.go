@@ -0,0 +1,149 @@
+package git
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"strings"
+
+	lib "gopkg.in/libgit2/git2go.v27"
+)
+
+// pickaxe filters the commits by their changes, it is built from the
+// CommitLoadOptions
+type pickaxe struct {
+	occurrence []byte
+	pattern    *regexp.Regexp
+}
+
+// newPickaxe returns nil if the options do not search the changes
+func newPickaxe(opts *CommitLoadOptions) (*pickaxe, error) {
+	if len(opts.Pickaxe) == 0 && len(opts.PickaxeRegex) == 0 {
+		return nil, nil
+	}
+	if len(opts.Pickaxe) > 0 && len(opts.PickaxeRegex) > 0 {
+		return nil, errors.New("an occurrence and a pattern cannot be searched together")
+	}
+	p := &pickaxe{}
+	if len(opts.Pickaxe) > 0 {
+		p.occurrence = []byte(opts.Pickaxe)
+	}
+	if len(opts.PickaxeRegex) > 0 {
+		re, err := regexp.Compile(opts.PickaxeRegex)
+		if err != nil {
+			return nil, err
+		}
+		p.pattern = re
+	}
+	return p, nil
+}
+
+// pickaxeMatch diffs the commit against its first parent. With an
+// occurrence the commit matches if the number of occurrences differs in any
+// file like "git log -S" does, with a pattern it matches if an added or
+// removed line matches like "git log -G" does. Merge commits never match,
+// git does not diff them for the pickaxe either.
+func (r *Repository) pickaxeMatch(p *pickaxe, commit *lib.Commit) (bool, error) {
+	if commit.ParentCount() > 1 {
+		return false, nil
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return false, err
+	}
+	defer tree.Free()
+	var parent *lib.Tree
+	if commit.ParentCount() > 0 {
+		pc := commit.Parent(0)
+		defer pc.Free()
+		if parent, err = pc.Tree(); err != nil {
+			return false, err
+		}
+		defer parent.Free()
+	}
+	opt, err := lib.DefaultDiffOptions()
+	if err != nil {
+		return false, err
+	}
+	diff, err := r.repo.DiffTreeToTree(parent, tree, &opt)
+	if err != nil {
+		return false, err
+	}
+	defer diff.Free()
+	// a renamed file is compared with its old path, otherwise the move
+	// looks like the occurrences are removed and added
+	findOpts, err := lib.DefaultDiffFindOptions()
+	if err != nil {
+		return false, err
+	}
+	findOpts.Flags |= lib.DiffFindRenames
+	if err := diff.FindSimilar(&findOpts); err != nil {
+		return false, err
+	}
+	deltas, err := diff.NumDeltas()
+	if err != nil {
+		return false, err
+	}
+	for i := 0; i < deltas; i++ {
+		if p.occurrence != nil {
+			delta, err := diff.GetDelta(i)
+			if err != nil {
+				return false, err
+			}
+			if r.countInBlob(delta.OldFile.Oid, p.occurrence) != r.countInBlob(delta.NewFile.Oid, p.occurrence) {
+				return true, nil
+			}
+		}
+		if p.pattern != nil {
+			matched, err := patchMatches(diff, i, p.pattern)
+			if err != nil {
+				return false, err
+			}
+			if matched {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// countInBlob counts the occurrences in the blob, a missing blob has none
+func (r *Repository) countInBlob(oid *lib.Oid, occurrence []byte) int {
+	if oid == nil || oid.IsZero() {
+		return 0
+	}
+	blob, err := r.repo.LookupBlob(oid)
+	if err != nil {
+		return 0
+	}
+	defer blob.Free()
+	return bytes.Count(blob.Contents(), occurrence)
+}
+
+// patchMatches is true if an added or removed line of the delta matches
+func patchMatches(diff *lib.Diff, index int, re *regexp.Regexp) (bool, error) {
+	patch, err := diff.Patch(index)
+	if err != nil {
+		return false, err
+	}
+	defer patch.Free()
+	text, err := patch.String()
+	if err != nil {
+		return false, err
+	}
+	// the file headers before the first hunk look like changed lines
+	inHunk := false
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(line, "@@") {
+			inHunk = true
+			continue
+		}
+		if !inHunk {
+			continue
+		}
+		if (strings.HasPrefix(line, "+") || strings.HasPrefix(line, "-")) && re.MatchString(line[1:]) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
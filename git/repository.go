@@ -1,6 +1,8 @@
 package git
 
 import (
+	"errors"
+
 	lib "gopkg.in/libgit2/git2go.v27"
 )
 
@@ -11,6 +13,7 @@ type Repository struct {
 	AbsPath  string
 	repo     *lib.Repository
 	Status   *Status
+	Head     *Head
 	Branch   *Branch
 	Branches []*Branch
 	Commits  []*Commit
@@ -18,6 +21,11 @@ type Repository struct {
 	Tags     []*Tag
 	Ahead    int
 	Behind   int
+	// ProtectedBranches can not be deleted
+	ProtectedBranches []string
+
+	expandedDirs map[string]bool
+	showIgnored  bool
 }
 
 // Remote is to communicate with the outside world. fetch, pull or push operations
@@ -27,6 +35,9 @@ type Remote struct {
 	URL  []string
 }
 
+// ErrBareRepository is returned by the operations that need a working dir
+var ErrBareRepository = errors.New("this operation must be run in a work tree, the repository is bare")
+
 // Open the repository from given path and return Repository pointer
 func Open(path string) (*Repository, error) {
 	r, err := lib.OpenRepository(path)
@@ -39,12 +50,24 @@ func Open(path string) (*Repository, error) {
 		AbsPath: path,
 		repo:    r,
 	}
+	// a bare repository has no working dir to read the status from
+	if repo.IsBare() {
+		if err := repo.loadHead(); err != nil {
+			return nil, err
+		}
+		return repo, nil
+	}
 	if err := repo.loadStatus(); err != nil {
 		return nil, err
 	}
 	return repo, err
 }
 
+// IsBare is true if the repository has no working dir
+func (r *Repository) IsBare() bool {
+	return r.repo.IsBare()
+}
+
 // InitializeBranches loads the branches
 func (r *Repository) InitializeBranches() error {
 	if err := r.loadBranches(); err != nil {
@@ -55,6 +78,9 @@ func (r *Repository) InitializeBranches() error {
 
 // InitializeStatus loads the files of working dir
 func (r *Repository) InitializeStatus() error {
+	if r.IsBare() {
+		return ErrBareRepository
+	}
 	if err := r.loadStatus(); err != nil {
 		return err
 	}
@@ -71,6 +97,12 @@ func (r *Repository) InitializeTags() error {
 
 // InitializeCommits loads all commits from current HEAD
 func (r *Repository) InitializeCommits(opts *CommitLoadOptions) error {
+	if err := r.loadHead(); err != nil {
+		return err
+	}
+	if r.Head.State == HeadUnborn {
+		return ErrUnbornHead
+	}
 	if shallow, err := r.repo.IsShallow(); shallow || err != nil {
 		commits, err := r.failOverShallow(opts)
 		r.Commits = commits
@@ -1,10 +1,10 @@
 package git
 
 import (
-	"os/exec"
+	"sort"
+	"strconv"
 	"strings"
 
-	log "github.com/sirupsen/logrus"
 	lib "gopkg.in/libgit2/git2go.v27"
 )
 
@@ -34,6 +34,7 @@ const (
 	IndexTypeUnstaged
 	IndexTypeUntracked
 	IndexTypeConflicted
+	IndexTypeIgnored
 )
 
 // StatusEntryType describes the type of change a status entry has undergone
@@ -68,93 +69,284 @@ type Status struct {
 }
 
 func (r *Repository) loadStatus() error {
+	// a commit or a checkout may move HEAD, so it is read along with status
+	if err := r.loadHead(); err != nil {
+		return err
+	}
 	statusOptions := &lib.StatusOptions{
-		Show:  lib.StatusShowIndexAndWorkdir,
-		Flags: lib.StatusOptIncludeUntracked,
+		Show: lib.StatusShowIndexAndWorkdir,
+		Flags: lib.StatusOptIncludeUntracked | lib.StatusOptRenamesHeadToIndex |
+			lib.StatusOptRenamesIndexToWorkdir,
 	}
-	statusList, err := r.repo.StatusList(statusOptions)
+	if r.showIgnored {
+		statusOptions.Flags |= lib.StatusOptIncludeIgnored
+	}
+	entries, err := r.statusEntries(statusOptions)
 	if err != nil {
 		return err
 	}
+	if entries, err = r.expandUntracked(entries); err != nil {
+		return err
+	}
+	// keep the entries grouped by their index type; staged, unstaged,
+	// untracked and conflicted respectively
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].index < entries[j].index
+	})
+	s := &Status{
+		State:   State(r.repo.State()),
+		Entries: entries,
+	}
+	r.Status = s
+	return nil
+}
+
+// statusEntries reads the status list of the lib with the given options
+func (r *Repository) statusEntries(statusOptions *lib.StatusOptions) ([]*StatusEntry, error) {
+	statusList, err := r.repo.StatusList(statusOptions)
+	if err != nil {
+		return nil, err
+	}
 	defer statusList.Free()
 
 	count, err := statusList.EntryCount()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	entries := make([]*StatusEntry, 0)
 	for i := 0; i < count; i++ {
 		statusEntry, err := statusList.ByIndex(i)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		if statusEntry.Status <= 0 {
 			continue
 		}
-		index := getIndex(statusEntry.Status)
-		var dd lib.DiffDelta
-		if index == IndexTypeStaged {
-			dd = statusEntry.HeadToIndex
-		} else {
-			dd = statusEntry.IndexToWorkdir
+		// a file can be both staged and modified again in the working dir, so
+		// each side of the change becomes a separate entry
+		for _, index := range getIndexes(statusEntry.Status) {
+			var dd lib.DiffDelta
+			if index == IndexTypeStaged {
+				dd = statusEntry.HeadToIndex
+			} else {
+				dd = statusEntry.IndexToWorkdir
+			}
+			if index == IndexTypeConflicted && len(dd.OldFile.Path) == 0 {
+				dd = statusEntry.HeadToIndex
+			}
+			d := newDiffDelta(dd)
+			e := &StatusEntry{
+				index:           index,
+				statusEntryType: StatusEntryType(dd.Status),
+				diffDelta:       d,
+			}
+			if index == IndexTypeConflicted {
+				e.statusEntryType = StatusEntryTypeConflicted
+			}
+			entries = append(entries, e)
 		}
-		d := &DiffDelta{
-			Status: int(dd.Status),
-			NewFile: &DiffFile{
-				Path: dd.NewFile.Path,
-			},
-			OldFile: &DiffFile{
-				Path: dd.OldFile.Path,
-			},
+	}
+	return entries, nil
+}
+
+// expandUntracked replaces the untracked directories that are expanded
+// before with the files in them
+func (r *Repository) expandUntracked(entries []*StatusEntry) ([]*StatusEntry, error) {
+	if len(r.expandedDirs) == 0 {
+		return entries, nil
+	}
+	expanded := make([]*StatusEntry, 0)
+	for _, e := range entries {
+		if !e.UntrackedDir() || !r.expandedDirs[e.Path()] {
+			expanded = append(expanded, e)
+			continue
 		}
-		e := &StatusEntry{
-			index:           index,
-			statusEntryType: StatusEntryType(dd.Status),
-			diffDelta:       d,
+		files, err := r.statusEntries(&lib.StatusOptions{
+			Show:     lib.StatusShowWorkdirOnly,
+			Flags:    lib.StatusOptIncludeUntracked | lib.StatusOptRecurseUntrackedDirs,
+			Pathspec: []string{e.Path()},
+		})
+		if err != nil {
+			return nil, err
 		}
-		entries = append(entries, e)
+		expanded = append(expanded, files...)
 	}
-	s := &Status{
-		State:   State(r.repo.State()),
-		Entries: entries,
+	return expanded, nil
+}
+
+// ExpandUntracked lists the files in an untracked directory instead of the
+// directory itself, it stays expanded when the status is reloaded
+func (r *Repository) ExpandUntracked(e *StatusEntry) error {
+	if !e.UntrackedDir() {
+		return nil
 	}
-	r.Status = s
-	return nil
+	if r.expandedDirs == nil {
+		r.expandedDirs = make(map[string]bool)
+	}
+	r.expandedDirs[e.Path()] = true
+	return r.loadStatus()
+}
+
+const (
+	statusIndexFlags = lib.StatusIndexNew | lib.StatusIndexModified |
+		lib.StatusIndexDeleted | lib.StatusIndexRenamed | lib.StatusIndexTypeChange
+	statusWorkdirFlags = lib.StatusWtModified | lib.StatusWtDeleted |
+		lib.StatusWtTypeChange | lib.StatusWtRenamed
+)
+
+// getIndexes returns every index type that the status flags fall into
+func getIndexes(s lib.Status) []IndexType {
+	if s&lib.StatusConflicted != 0 {
+		return []IndexType{IndexTypeConflicted}
+	}
+	indexes := make([]IndexType, 0)
+	if s&statusIndexFlags != 0 {
+		indexes = append(indexes, IndexTypeStaged)
+	}
+	if s&statusWorkdirFlags != 0 {
+		indexes = append(indexes, IndexTypeUnstaged)
+	}
+	if s&lib.StatusWtNew != 0 {
+		indexes = append(indexes, IndexTypeUntracked)
+	}
+	if s&lib.StatusIgnored != 0 {
+		indexes = append(indexes, IndexTypeIgnored)
+	}
+	return indexes
 }
 
-func getIndex(s lib.Status) IndexType {
-	if s == lib.StatusWtModified || s == lib.StatusWtDeleted || s == lib.StatusWtTypeChange || s == lib.StatusWtRenamed {
-		return IndexTypeUnstaged
-	} else if s == lib.StatusWtNew {
-		return IndexTypeUntracked
-	} else if s == lib.StatusConflicted {
-		return IndexTypeConflicted
+// String returns the section name of the index type
+func (i IndexType) String() string {
+	switch i {
+	case IndexTypeStaged:
+		return "Staged"
+	case IndexTypeUnstaged:
+		return "Unstaged"
+	case IndexTypeUntracked:
+		return "Untracked"
+	case IndexTypeConflicted:
+		return "Conflicted"
+	case IndexTypeIgnored:
+		return "Ignored"
+	default:
+		return "Unknown"
 	}
-	return IndexTypeStaged
 }
 
 func (e *StatusEntry) String() string {
+	if e.Renamed() {
+		return e.diffDelta.OldFile.Path + " → " + e.diffDelta.NewFile.Path +
+			" (" + strconv.Itoa(e.diffDelta.Similarity) + "%)"
+	}
 	return e.diffDelta.OldFile.Path
 }
 
-// Patch return the diff of the entry
-func (e *StatusEntry) Patch() string {
-	var cmd *exec.Cmd
-	if e.statusEntryType == StatusEntryTypeUntracked {
-		cmd = exec.Command("git", "diff", "--no-index", "/dev/null", e.diffDelta.NewFile.Path)
-	} else {
-		cmd = exec.Command("git", "diff", e.diffDelta.OldFile.Path)
+// Path returns the current path of the entry
+func (e *StatusEntry) Path() string {
+	if len(e.diffDelta.NewFile.Path) > 0 {
+		return e.diffDelta.NewFile.Path
+	}
+	return e.diffDelta.OldFile.Path
+}
+
+// ShowIgnored sets whether the ignored files are listed in the status
+func (r *Repository) ShowIgnored(show bool) error {
+	r.showIgnored = show
+	return r.loadStatus()
+}
+
+// ShowingIgnored is true if the ignored files are listed in the status
+func (r *Repository) ShowingIgnored() bool {
+	return r.showIgnored
+}
+
+// UntrackedDir is true if the entry is an untracked directory that is not
+// listed file by file
+func (e *StatusEntry) UntrackedDir() bool {
+	return e.index == IndexTypeUntracked && strings.HasSuffix(e.Path(), "/")
+}
+
+// Renamed is true if the entry is moved to another path
+func (e *StatusEntry) Renamed() bool {
+	return e.statusEntryType == StatusEntryTypeRenamed &&
+		e.diffDelta.OldFile.Path != e.diffDelta.NewFile.Path
+}
+
+// DiffEntry generates the diff of the entry; HEAD to index for staged
+// entries, index to working dir for the others. Untracked files are diffed
+// as if all of their lines are added.
+func (r *Repository) DiffEntry(e *StatusEntry) (*Diff, error) {
+	index, err := r.repo.Index()
+	if err != nil {
+		return nil, err
+	}
+	defer index.Free()
+
+	opt, err := lib.DefaultDiffOptions()
+	if err != nil {
+		return nil, err
+	}
+	opt.Pathspec = e.paths()
+	if !strings.HasSuffix(e.diffDelta.NewFile.Path, "/") {
+		opt.Flags |= lib.DiffDisablePathspecMatch
+	}
+
+	var diff *lib.Diff
+	switch e.index {
+	case IndexTypeStaged:
+		var commit *lib.Commit
+		if commit, err = r.headCommit(); err != nil {
+			return nil, err
+		}
+		var tree *lib.Tree
+		if commit != nil {
+			defer commit.Free()
+			if tree, err = commit.Tree(); err != nil {
+				return nil, err
+			}
+			defer tree.Free()
+		}
+		diff, err = r.repo.DiffTreeToIndex(tree, index, &opt)
+	case IndexTypeUntracked:
+		opt.Flags |= lib.DiffIncludeUntracked | lib.DiffRecurseUntracked | lib.DiffShowUntrackedContent
+		diff, err = r.repo.DiffIndexToWorkdir(index, &opt)
+	default:
+		if e.Renamed() {
+			// the new path of a rename in the working dir is not tracked yet
+			opt.Flags |= lib.DiffIncludeUntracked
+		}
+		diff, err = r.repo.DiffIndexToWorkdir(index, &opt)
 	}
-	out, err := cmd.CombinedOutput()
 	if err != nil {
-		log.Warn(err.Error())
+		return nil, err
+	}
+	defer diff.Free()
+	if e.Renamed() {
+		findOpts, err := lib.DefaultDiffFindOptions()
+		if err != nil {
+			return nil, err
+		}
+		findOpts.Flags |= lib.DiffFindRenames | lib.DiffFindForUntracked
+		if err := diff.FindSimilar(&findOpts); err != nil {
+			return nil, err
+		}
 	}
-	return strings.Join(colorizeDiff(string(out)), "\n")
+	return newDiff(diff)
 }
 
 // StatusEntryString returns entry status in pretty format
 func (e *StatusEntry) StatusEntryString() string {
-	switch e.statusEntryType {
+	return e.statusEntryType.String()
+}
+
+// Type returns the type of change the entry has undergone
+func (e *StatusEntry) Type() StatusEntryType {
+	return e.statusEntryType
+}
+
+// String returns the status entry type in pretty format
+func (t StatusEntryType) String() string {
+	switch t {
 	case StatusEntryTypeUnmodified:
 		return ""
 	case StatusEntryTypeAdded:
@@ -182,6 +374,11 @@ func (e *StatusEntry) StatusEntryString() string {
 	}
 }
 
+// Index returns the stage that the entry is in
+func (e *StatusEntry) Index() IndexType {
+	return e.index
+}
+
 // Indexed true if entry added to index
 func (e *StatusEntry) Indexed() bool {
 	if e.index == IndexTypeStaged {
@@ -190,42 +387,6 @@ func (e *StatusEntry) Indexed() bool {
 	return false
 }
 
-// AddEntry is the wrapper of "git add /path/to/file" command
-func (r *Repository) AddEntry(e *StatusEntry) error {
-	cmd := exec.Command("git", "add", "--", e.diffDelta.OldFile.Path)
-	if err := cmd.Run(); err != nil {
-		return err
-	}
-	return r.loadStatus()
-}
-
-// ResetEntry is the wrapper of "git reset path/to/file" command
-func (r *Repository) ResetEntry(e *StatusEntry) error {
-	cmd := exec.Command("git", "reset", "HEAD", "--", e.diffDelta.OldFile.Path)
-	if err := cmd.Run(); err != nil {
-		return err
-	}
-	return r.loadStatus()
-}
-
-// AddAll is the wrapper of "git add ." command
-func (r *Repository) AddAll() error {
-	cmd := exec.Command("git", "add", ".")
-	if err := cmd.Run(); err != nil {
-		return err
-	}
-	return r.loadStatus()
-}
-
-// ResetAll is the wrapper of "git reset" command
-func (r *Repository) ResetAll() error {
-	cmd := exec.Command("git", "reset", "--mixed")
-	if err := cmd.Run(); err != nil {
-		return err
-	}
-	return r.loadStatus()
-}
-
 // NumberOfIndexedEntries returns the count of indexed files in the working dir
 func (r *Repository) NumberOfIndexedEntries() int {
 	count := 0
@@ -0,0 +1,80 @@
+package git
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Trailer is a "Key: value" line at the end of a commit message such as
+// Signed-off-by or Co-authored-by
+type Trailer struct {
+	Key   string
+	Value string
+}
+
+var trailerLine = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9-]*):\s*(.*)$`)
+
+func (t *Trailer) String() string {
+	return t.Key + ": " + t.Value
+}
+
+// parseMessage splits the commit message into its body and trailers. The
+// summary line is not a part of the body and the trailers are read from
+// the last paragraph only if every line of it is a trailer, lines starting
+// with a space continue the previous trailer like "git interpret-trailers"
+func parseMessage(message string) (string, []*Trailer) {
+	lines := strings.Split(strings.TrimRight(message, "\n"), "\n")
+	// skip the summary, which may span several lines until a blank one
+	start := 0
+	for start < len(lines) && len(strings.TrimSpace(lines[start])) > 0 {
+		start++
+	}
+	lines = lines[start:]
+
+	last := len(lines)
+	for last > 0 && len(strings.TrimSpace(lines[last-1])) == 0 {
+		last--
+	}
+	first := last
+	for first > 0 && len(strings.TrimSpace(lines[first-1])) > 0 {
+		first--
+	}
+	trailers := make([]*Trailer, 0)
+	for _, line := range lines[first:last] {
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			if len(trailers) == 0 {
+				trailers = nil
+				break
+			}
+			prev := trailers[len(trailers)-1]
+			prev.Value = prev.Value + " " + strings.TrimSpace(line)
+			continue
+		}
+		match := trailerLine.FindStringSubmatch(line)
+		if match == nil {
+			trailers = nil
+			break
+		}
+		trailers = append(trailers, &Trailer{
+			Key:   match[1],
+			Value: strings.TrimSpace(match[2]),
+		})
+	}
+	// the paragraph is a part of the body if it is not made of trailers
+	if len(trailers) == 0 {
+		return strings.TrimSpace(strings.Join(lines, "\n")), []*Trailer{}
+	}
+	return strings.TrimSpace(strings.Join(lines[:first], "\n")), trailers
+}
+
+// TrailerValues returns the values of the trailers with the given key, the
+// key is not case sensitive
+func (c *Commit) TrailerValues(key string) []string {
+	values := make([]string, 0)
+	for _, t := range c.Trailers {
+		if strings.EqualFold(t.Key, key) {
+			values = append(values, t.Value)
+		}
+	}
+	return values
+}
@@ -0,0 +1,271 @@
+package git
+
+import (
+	"errors"
+	"path"
+	"sort"
+	"strconv"
+
+	lib "gopkg.in/libgit2/git2go.v27"
+)
+
+// TreeEntry is a file or a directory in the tree of a commit
+type TreeEntry struct {
+	Name string
+	// Path is relative to the root of the repository
+	Path string
+	Hash string
+	Mode FileMode
+	Size int64
+	// LastCommit is the latest commit that changed the entry, it is nil if
+	// it could not be found in the searched history
+	LastCommit *Commit
+}
+
+// maxTreeWalk limits the commits searched for the last commits of entries
+const maxTreeWalk = 10000
+
+// ResolveRevision returns the commit of the revision e.g. HEAD~2, a tag, a
+// branch or a hash
+func (r *Repository) ResolveRevision(rev string) (*Commit, error) {
+	obj, err := r.repo.RevparseSingle(rev)
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Free()
+	peeled, err := obj.Peel(lib.ObjectCommit)
+	if err != nil {
+		return nil, errors.New(rev + " does not point to a commit")
+	}
+	defer peeled.Free()
+	commit, err := peeled.AsCommit()
+	if err != nil {
+		return nil, err
+	}
+	c := newCommit(commit)
+	c.Tag = r.findTag(c.Hash)
+	return c, nil
+}
+
+// TreeEntries lists the entries of the dir in the tree of the commit,
+// directories come first. The last commit of each entry is searched from
+// the commit backwards.
+func (r *Repository) TreeEntries(c *Commit, dir string) ([]*TreeEntry, error) {
+	root, err := c.commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	defer root.Free()
+	tree, err := subtree(r.repo, root, dir)
+	if err != nil {
+		return nil, err
+	}
+	if tree != root {
+		defer tree.Free()
+	}
+	entries := make([]*TreeEntry, 0)
+	count := tree.EntryCount()
+	for i := uint64(0); i < count; i++ {
+		te := tree.EntryByIndex(i)
+		e := &TreeEntry{
+			Name: te.Name,
+			Path: path.Join(dir, te.Name),
+			Hash: te.Id.String(),
+			Mode: FileMode(te.Filemode),
+		}
+		if te.Type == lib.ObjectBlob {
+			if blob, err := r.repo.LookupBlob(te.Id); err == nil {
+				e.Size = blob.Size()
+				blob.Free()
+			}
+		}
+		entries = append(entries, e)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].IsDir() != entries[j].IsDir() {
+			return entries[i].IsDir()
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	if err := r.findLastCommits(c, entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// findLastCommits walks the history from the commit and sets the last
+// commit of each entry, a commit changes an entry if the entry differs
+// from the one in its parent. Merges are skipped, so a conflict resolved
+// in a merge is attributed to the merged commits.
+func (r *Repository) findLastCommits(c *Commit, entries []*TreeEntry) error {
+	pending := make(map[*TreeEntry]bool)
+	for _, e := range entries {
+		pending[e] = true
+	}
+	walked := 0
+	return r.walkChanges(c, func(commit *lib.Commit, tree, parent *lib.Tree) bool {
+		for e := range pending {
+			if entryID(tree, e.Path) != entryID(parent, e.Path) {
+				e.LastCommit = r.wrapCommit(commit)
+				delete(pending, e)
+			}
+		}
+		walked++
+		return len(pending) > 0 && walked < maxTreeWalk
+	})
+}
+
+// FileHistory returns the commits reachable from the commit that changed
+// the path, newest first
+func (r *Repository) FileHistory(c *Commit, path string) ([]*Commit, error) {
+	commits := make([]*Commit, 0)
+	err := r.walkChanges(c, func(commit *lib.Commit, tree, parent *lib.Tree) bool {
+		if entryID(tree, path) != entryID(parent, path) {
+			commits = append(commits, r.wrapCommit(commit))
+		}
+		return true
+	})
+	return commits, err
+}
+
+// walkChanges calls the visit func with the tree of each commit reachable
+// from c and the tree of its parent, which is nil for root commits. Merges
+// are not visited, their changes are found in the commits of the merged
+// branches which are walked as well, children before their parents. The walk
+// stops when visit returns false.
+func (r *Repository) walkChanges(c *Commit, visit func(commit *lib.Commit, tree, parent *lib.Tree) bool) error {
+	oid, err := lib.NewOid(c.Hash)
+	if err != nil {
+		return err
+	}
+	walk, err := r.repo.Walk()
+	if err != nil {
+		return err
+	}
+	defer walk.Free()
+	walk.Sorting(lib.SortTopological | lib.SortTime)
+	if err := walk.Push(oid); err != nil {
+		return err
+	}
+	var walkErr error
+	err = walk.Iterate(func(commit *lib.Commit) bool {
+		if commit.ParentCount() > 1 {
+			return true
+		}
+		tree, err := commit.Tree()
+		if err != nil {
+			walkErr = err
+			return false
+		}
+		defer tree.Free()
+		var parent *lib.Tree
+		if commit.ParentCount() > 0 {
+			p := commit.Parent(0)
+			defer p.Free()
+			if parent, err = p.Tree(); err != nil {
+				walkErr = err
+				return false
+			}
+			defer parent.Free()
+		}
+		return visit(commit, tree, parent)
+	})
+	if walkErr != nil {
+		return walkErr
+	}
+	return err
+}
+
+// wrapCommit wraps the commit with its decorations, the commit from the
+// loaded history is used if there is one
+func (r *Repository) wrapCommit(commit *lib.Commit) *Commit {
+	hash := commit.AsObject().Id().String()
+	for _, c := range r.Commits {
+		if c.Hash == hash {
+			return c
+		}
+	}
+	c := newCommit(commit)
+	c.Tag = r.findTag(c.Hash)
+	return c
+}
+
+// subtree returns the tree at the dir, root is returned for an empty dir
+func subtree(repo *lib.Repository, root *lib.Tree, dir string) (*lib.Tree, error) {
+	if len(dir) == 0 {
+		return root, nil
+	}
+	te, err := root.EntryByPath(dir)
+	if err != nil {
+		return nil, err
+	}
+	if te.Type != lib.ObjectTree {
+		return nil, errors.New(dir + " is not a directory")
+	}
+	return repo.LookupTree(te.Id)
+}
+
+// entryID returns the hash of the entry at the path, it is empty if the
+// tree is nil or the path does not exist
+func entryID(tree *lib.Tree, path string) string {
+	if tree == nil {
+		return ""
+	}
+	te, err := tree.EntryByPath(path)
+	if err != nil {
+		return ""
+	}
+	return te.Id.String()
+}
+
+// IsDir is true if the entry is a directory
+func (e *TreeEntry) IsDir() bool {
+	return e.Mode == FileModeTree
+}
+
+// Kind returns what the entry is e.g. "tree", "blob", "symlink"
+func (e *TreeEntry) Kind() string {
+	if kind := e.Mode.Kind(); len(kind) > 0 {
+		return kind
+	}
+	return "blob"
+}
+
+// SizeString returns the size in a human readable form, it is empty for
+// directories and submodules
+func (e *TreeEntry) SizeString() string {
+	if e.Mode == FileModeTree || e.Mode == FileModeCommit {
+		return "-"
+	}
+	size := float64(e.Size)
+	for _, unit := range []string{"B", "K", "M", "G"} {
+		if size < 1024 {
+			if unit == "B" {
+				return strconv.FormatInt(e.Size, 10) + unit
+			}
+			return strconv.FormatFloat(size, 'f', 1, 64) + unit
+		}
+		size = size / 1024
+	}
+	return strconv.FormatFloat(size, 'f', 1, 64) + "T"
+}
+
+// LastCommitSummary returns the summary and the date of the last commit
+func (e *TreeEntry) LastCommitSummary() string {
+	if e.LastCommit == nil {
+		return ""
+	}
+	return e.LastCommit.Summary + " (" + e.LastCommit.Since() + ")"
+}
+
+// FileAt returns the file of the tree entry in the commit
+func (r *Repository) FileAt(c *Commit, e *TreeEntry) (*FileVersion, error) {
+	if e.IsDir() {
+		return nil, errors.New(e.Path + " is a directory")
+	}
+	return r.fileVersion(c.Hash, &DiffFile{
+		Path: e.Path,
+		Hash: e.Hash,
+		Mode: e.Mode,
+	})
+}
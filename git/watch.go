@@ -0,0 +1,134 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+)
+
+// Watcher notifies the caller when the working dir, the index or the refs
+// of the repository change, so that the views can be reloaded
+type Watcher struct {
+	repository *Repository
+	watcher    *fsnotify.Watcher
+	debounce   time.Duration
+	onChange   func()
+	done       chan struct{}
+	once       sync.Once
+}
+
+// Watch starts watching the repository, onChange is called from the
+// watcher's goroutine once there are no events for the debounce duration
+func (r *Repository) Watch(debounce time.Duration, onChange func()) (*Watcher, error) {
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	w := &Watcher{
+		repository: r,
+		watcher:    fw,
+		debounce:   debounce,
+		onChange:   onChange,
+		done:       make(chan struct{}),
+	}
+	if err := w.addDirs(); err != nil {
+		fw.Close()
+		return nil, err
+	}
+	go w.run()
+	return w, nil
+}
+
+// Close stops the watcher, it is safe to call more than once
+func (w *Watcher) Close() {
+	w.once.Do(func() {
+		close(w.done)
+		w.watcher.Close()
+	})
+}
+
+// addDirs adds the directories of the working dir except the ignored ones,
+// and the git dir itself for HEAD and the index, and the refs
+func (w *Watcher) addDirs() error {
+	gitDir := filepath.Clean(w.repository.repo.Path())
+	if err := w.watcher.Add(gitDir); err != nil {
+		return err
+	}
+	if err := w.addTree(filepath.Join(gitDir, "refs")); err != nil {
+		return err
+	}
+	if w.repository.repo.IsBare() {
+		return nil
+	}
+	return w.addTree(w.repository.repo.Workdir())
+}
+
+// addTree adds the directory and its sub directories to the watch list
+func (w *Watcher) addTree(root string) error {
+	gitDir := filepath.Clean(w.repository.repo.Path())
+	workdir := w.repository.repo.Workdir()
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return nil
+		}
+		if filepath.Clean(path) == gitDir && path != root {
+			return filepath.SkipDir
+		}
+		if len(workdir) > 0 && strings.HasPrefix(path, workdir) {
+			rel := strings.TrimPrefix(path, workdir)
+			if ignored, _ := w.repository.repo.IsPathIgnored(rel); ignored && len(rel) > 0 {
+				return filepath.SkipDir
+			}
+		}
+		return w.watcher.Add(path)
+	})
+}
+
+func (w *Watcher) run() {
+	var timer *time.Timer
+	fire := make(chan struct{}, 1)
+	for {
+		select {
+		case <-w.done:
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if strings.HasSuffix(event.Name, ".lock") {
+				continue
+			}
+			if event.Op&fsnotify.Create != 0 {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					w.addTree(event.Name)
+				}
+			}
+			if timer != nil {
+				timer.Stop()
+			}
+			timer = time.AfterFunc(w.debounce, func() {
+				select {
+				case fire <- struct{}{}:
+				default:
+				}
+			})
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Warn(err.Error())
+		case <-fire:
+			if w.onChange != nil {
+				w.onChange()
+			}
+		}
+	}
+}
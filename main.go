@@ -13,15 +13,29 @@ import (
 )
 
 type Config struct {
-	LineSize int
-	HideHelp bool
+	LineSize  int
+	HideHelp  bool
+	Protected []string `default:"master,main"`
 }
 
 var (
 	cfg           Config
+	amCommand     = pin.Command("am", "Apply a series of patches from a mailbox.")
+	amMailbox     = amCommand.Arg("mbox", "mailbox file written by format-patch, omit to resolve a failed patch").String()
 	branchCommand = pin.Command("branch", "Checkout, list, or delete branches.")
 	branchAll     = branchCommand.Flag("all", "list both remote and local branches").Bool()
 	branchRemotes = branchCommand.Flag("remote", "list only remote branches").Bool()
+	branchSort    = branchCommand.Flag("sort", "sort branches by name, date, ahead or behind").Enum("name", "date", "ahead", "behind")
+	branchMerged  = branchCommand.Flag("merged", "list only branches merged into given branch").String()
+	branchNoMerge = branchCommand.Flag("no-merged", "list only branches not merged into given branch").String()
+	branchCleanup = branchCommand.Flag("cleanup", "delete stale local branches in bulk").Bool()
+	branchBase    = branchCommand.Flag("base", "base branch to detect merged branches for cleanup").String()
+	branchDays    = branchCommand.Flag("days", "branches without commits for given days are stale").Default("90").Int()
+	grepCommand   = pin.Command("grep", "Search the tracked files or the files of a revision.")
+	grepIgnore    = grepCommand.Flag("ignore-case", "ignore case differences between the pattern and the files").Short('i').Bool()
+	grepPattern   = grepCommand.Arg("pattern", "regular expression to search").Required().String()
+	grepRevision  = grepCommand.Arg("rev", "revision to search instead of the working tree").String()
+	grepPathspecs = grepCommand.Arg("pathspec", "limit the search to the matching paths").Strings()
 	logCommand    = pin.Command("log", "Show commit logs.")
 	logAhead      = logCommand.Flag("ahead", "show commits that not pushed to upstream").Bool()
 	logAuthor     = logCommand.Flag("author", "limit commits to those by given author").String()
@@ -31,7 +45,18 @@ var (
 	logMaxCount   = logCommand.Flag("max-count", "maximum number of commits to display").Int()
 	logTags       = logCommand.Flag("tags", "show tags alongside commits").Bool()
 	logSince      = logCommand.Flag("since", "show commits newer than given date (RFC3339)").String()
+	logPickaxe    = logCommand.Flag("pickaxe", "show commits that change the number of occurrences of given string").Short('S').String()
+	logRegex      = logCommand.Flag("pickaxe-regex", "show commits that add or remove lines matching given regex").Short('G').String()
 	status        = pin.Command("status", "Show working-tree status. Also stage and commit changes.")
+	statusTree    = status.Flag("tree", "group entries by directory").Bool()
+	statusOnly    = status.Flag("only", "show only one section of the entries").Enum("staged", "unstaged", "untracked", "conflicted", "ignored")
+	statusType    = status.Flag("type", "show only entries with given change type").Enum("added", "deleted", "modified", "renamed", "typechange", "untracked", "conflicted", "ignored")
+	statusIgnored = status.Flag("ignored", "show ignored files as well").Bool()
+	treeCommand   = pin.Command("tree", "Browse the files of a revision.")
+	treeRevision  = treeCommand.Arg("rev", "revision to browse, HEAD if omitted").String()
+	undoCommand   = pin.Command("undo", "Undo the last operation made with gitin.")
+	undoRedo      = undoCommand.Flag("redo", "apply the last undone operation again").Bool()
+	undoList      = undoCommand.Flag("list", "list the logged operations").Bool()
 )
 
 func main() {
@@ -57,6 +82,7 @@ func run(path string) error {
 	if err != nil {
 		return err
 	}
+	r.ProtectedBranches = cfg.Protected
 	promptOps := &cli.PromptOptions{
 		Cursor:   0,
 		Scroll:   0,
@@ -64,6 +90,12 @@ func run(path string) error {
 		HideHelp: cfg.HideHelp,
 	}
 	switch pin.Parse() {
+	case "am":
+		opts := &cli.AmOptions{
+			Mailbox:   *amMailbox,
+			PromptOps: promptOps,
+		}
+		return cli.AmBuilder(r, opts)
 	case "branch":
 		types := cli.LocalBranches
 		if *branchAll {
@@ -72,10 +104,30 @@ func run(path string) error {
 			types = cli.RemoteBranches
 		}
 		opts := &cli.BranchOptions{
-			Types:     types,
-			PromptOps: promptOps,
+			Types:        types,
+			Sort:         cli.ParseBranchSort(*branchSort),
+			Base:         *branchBase,
+			Cleanup:      *branchCleanup,
+			InactiveDays: *branchDays,
+			PromptOps:    promptOps,
+		}
+		if len(*branchMerged) > 0 {
+			opts.Base = *branchMerged
+			opts.MergeFilter = cli.MergedBranches
+		} else if len(*branchNoMerge) > 0 {
+			opts.Base = *branchNoMerge
+			opts.MergeFilter = cli.UnmergedBranches
 		}
 		return cli.BranchBuilder(r, opts)
+	case "grep":
+		opts := &cli.GrepOptions{
+			Pattern:    *grepPattern,
+			Revision:   *grepRevision,
+			Pathspecs:  *grepPathspecs,
+			IgnoreCase: *grepIgnore,
+			PromptOps:  promptOps,
+		}
+		return cli.GrepBuilder(r, opts)
 	case "log":
 		opts := &cli.LogOptions{
 			Author:    *logAuthor,
@@ -84,6 +136,8 @@ func run(path string) error {
 			Tags:      *logTags,
 			MaxCount:  *logMaxCount,
 			Since:     *logSince,
+			Pickaxe:   *logPickaxe,
+			Regex:     *logRegex,
 			PromptOps: promptOps,
 		}
 		if *logAhead {
@@ -98,9 +152,25 @@ func run(path string) error {
 		}
 	case "status":
 		opts := &cli.StatusOptions{
+			Tree:      *statusTree,
+			Only:      *statusOnly,
+			Type:      *statusType,
+			Ignored:   *statusIgnored,
 			PromptOps: promptOps,
 		}
 		return cli.StatusBuilder(r, opts)
+	case "tree":
+		opts := &cli.TreeOptions{
+			Revision:  *treeRevision,
+			PromptOps: promptOps,
+		}
+		return cli.TreeBuilder(r, opts)
+	case "undo":
+		opts := &cli.UndoOptions{
+			Redo: *undoRedo,
+			List: *undoList,
+		}
+		return cli.UndoBuilder(r, opts)
 	}
 	return nil
 }